@@ -1,46 +1,57 @@
 package goriak
 
 import (
-	"errors"
-	riak "github.com/basho/riak-go-client"
+	"context"
 )
 
 type AllKeysCommand struct {
-	c       *Command
-	builder *riak.ListKeysCommandBuilder
+	c        *Command
+	req      *listKeysRequest
+	callback func([]string) error
 }
 
 // AllKeys returns all keys in the set bucket.
 // The response will be sent in multiple batches to callback
 func (c *Command) AllKeys(callback func([]string) error) *AllKeysCommand {
-	builder := riak.NewListKeysCommandBuilder().
-		WithBucket(c.bucket).
-		WithBucketType(c.bucketType).
-		WithCallback(callback).
-		WithAllowListing(). // Required as of github.com/basho/riak-go-client 1.9.0
-		WithStreaming(true)
-
 	return &AllKeysCommand{
-		c:       c,
-		builder: builder,
+		c: c,
+		req: &listKeysRequest{
+			bucket:     c.bucket,
+			bucketType: c.bucketType,
+		},
+		callback: callback,
 	}
 }
 
 func (c *AllKeysCommand) Run(session *Session) (*Result, error) {
-	cmd, err := c.builder.Build()
-	if err != nil {
-		return nil, err
-	}
+	return c.RunContext(context.Background(), session)
+}
 
-	err = session.riak.Execute(cmd)
-	if err != nil {
-		return nil, err
+// RunContext is the same as Run, but aborts the command when ctx is cancelled or reaches its deadline.
+// The stream of keys is aborted as soon as ctx is done, and callback will not be called again.
+func (c *AllKeysCommand) RunContext(ctx context.Context, session *Session) (*Result, error) {
+	middlewarer := &commandMiddlewarer{
+		bucket:     c.c.bucket,
+		bucketType: c.c.bucketType,
+		ctx:        ctx,
+		operation:  OperationAllKeys,
 	}
 
-	res := cmd.(*riak.ListKeysCommand)
+	return runMiddleware(ctx, middlewarer, c.c.runMiddleware, c.riakExec, session)
+}
+
+func (c *AllKeysCommand) riakExec(ctx context.Context, session *Session) (*Result, error) {
+	c.req.callback = func(keys []string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		return c.callback(keys)
+	}
 
-	if !res.Success() {
-		return nil, errors.New("not successful")
+	err := session.execute(ctx, c.req)
+	if err != nil {
+		return nil, err
 	}
 
 	return &Result{}, nil
@@ -1,6 +1,7 @@
 package goriak
 
 import (
+	"errors"
 	"reflect"
 	"testing"
 )
@@ -131,3 +132,54 @@ func TestCustomTypeUint8(t *testing.T) {
 
 	t.Logf("%+v", output)
 }
+
+func TestAutoMapArrayShortValue(t *testing.T) {
+	type writeType struct {
+		ID  []byte
+		IDs [][]byte
+	}
+
+	result, err := bucket().Set(writeType{
+		ID:  []byte{1, 2, 3},
+		IDs: [][]byte{{1, 2, 3}},
+	}).Run(con())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Values that are shorter than the array are not read
+	type ptrType struct {
+		ID *ourID
+	}
+
+	_, err = bucket().Get(result.Key, &ptrType{}).Run(con())
+	if !errors.Is(err, ErrUnsupportedType) || err.Error() != "Invalid length 3 for goriak.ourID, expected 10" {
+		t.Error("unexpected error:", err)
+	}
+
+	type setType struct {
+		IDs []ourID
+	}
+
+	_, err = bucket().Get(result.Key, &setType{}).Run(con())
+
+	var typeErr *UnsupportedTypeError
+	if !errors.As(err, &typeErr) || typeErr.Path != "IDs" || typeErr.Type != reflect.TypeOf(ourID{}) {
+		t.Error("unexpected error:", err)
+	}
+
+	type arrayType struct {
+		ID ourID
+	}
+
+	var res arrayType
+	_, err = bucket().Get(result.Key, &res).Run(con())
+	if !errors.As(err, &typeErr) || typeErr.Path != "ID" {
+		t.Error("unexpected error:", err)
+	}
+
+	if res.ID != (ourID{}) {
+		t.Error("unexpected value:", res.ID)
+	}
+}
@@ -1,10 +1,10 @@
 package goriak
 
 import (
-	"errors"
+	"encoding/json"
 	"reflect"
+	"sort"
 	"strconv"
-	"time"
 
 	riak "github.com/basho/riak-go-client"
 )
@@ -23,30 +23,57 @@ func decodeInterface(data *riak.FetchMapResponse, output interface{}, riakReques
 // Assings values from a Riak Map to a receiving Go struct
 func transMapToStruct(data *riak.Map, rValue reflect.Value, rType reflect.Type, riakContext []byte, path []string, riakRequest requestData) error {
 
-	num := rType.NumField()
+	// Fields in embedded structs are read from the same map, see mapFields
+	for _, field := range mapFields(rType) {
 
-	for i := 0; i < num; i++ {
+		fieldVal, ok := fieldByIndexAlloc(rValue, field.Index)
 
-		field := rType.Field(i)
-		fieldVal := rValue.Field(i)
-		registerName := field.Name
-		tag := field.Tag.Get("goriak")
+		if !ok {
+			continue
+		}
+
+		registerName := field.name
 
 		// goriakcontext is a reserved keyword.
 		// Use the tag `goriak:"goriakcontext"` to get the Riak context necessary for certaion Riak operations,
 		// such as removing items from a Set.
-		if tag == "goriakcontext" {
-			rValue.Field(i).SetBytes(riakContext)
+		if field.Tag.Get("goriak") == "goriakcontext" {
+			fieldVal.SetBytes(riakContext)
 			continue
 		}
 
-		// Ignore this value
-		if tag == "-" {
+		// Types with their own unmarshaler, such as time.Time
+		if done, err := decodeUnmarshaler(fieldVal, registerName, data); done {
+			if err != nil {
+				return err
+			}
+
 			continue
 		}
 
-		if len(tag) > 0 {
-			registerName = tag
+		// Slices of structs saved as a map, keyed by a field in the struct
+		if keyField := field.Tag.Get("goriakkey"); len(keyField) > 0 {
+			err := transMapToKeyedSlice(fieldVal, registerName, keyField, data, riakContext, path, riakRequest)
+
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		// Pointers to []byte and [N]byte types
+		if field.Type.Kind() == reflect.Ptr && isBytesType(field.Type) {
+			if val, ok := data.Registers[registerName]; ok {
+				newVal, err := bytesToValue(val, field.Type, append(path, registerName))
+				if err != nil {
+					return err
+				}
+
+				fieldVal.Set(newVal)
+			}
+
+			continue
 		}
 
 		switch field.Type.Kind() {
@@ -73,10 +100,21 @@ func transMapToStruct(data *riak.Map, rValue reflect.Value, rType reflect.Type,
 		case reflect.Uint32:
 			fallthrough
 		case reflect.Uint64:
+			fallthrough
+		case reflect.Float32:
+			fallthrough
+		case reflect.Float64:
+			fallthrough
+		case reflect.Complex64:
+			fallthrough
+		case reflect.Complex128:
 			if val, ok := data.Registers[registerName]; ok {
-				if newVal, err := bytesToValue(val, field.Type); err == nil {
-					fieldVal.Set(newVal)
+				newVal, err := bytesToValue(val, field.Type, append(path, registerName))
+				if err != nil {
+					return err
 				}
+
+				fieldVal.Set(newVal)
 			}
 
 		case reflect.Bool:
@@ -85,7 +123,7 @@ func transMapToStruct(data *riak.Map, rValue reflect.Value, rType reflect.Type,
 			}
 
 		case reflect.Slice:
-			err := transRiakToSlice(rValue.Field(i), registerName, data)
+			err := transRiakToSlice(fieldVal, registerName, data, path)
 
 			if err != nil {
 				return err
@@ -93,7 +131,7 @@ func transMapToStruct(data *riak.Map, rValue reflect.Value, rType reflect.Type,
 
 		case reflect.Map:
 			if subMap, ok := data.Maps[registerName]; ok {
-				err := transMapToMap(rValue.Field(i), subMap)
+				err := transMapToMap(fieldVal, subMap, riakContext, append(path, registerName), riakRequest)
 
 				if err != nil {
 					return err
@@ -101,33 +139,13 @@ func transMapToStruct(data *riak.Map, rValue reflect.Value, rType reflect.Type,
 			}
 
 		case reflect.Struct:
-			done := false
-
-			// time.Time
-			if bin, ok := data.Registers[registerName]; ok {
-				if ts, ok := fieldVal.Interface().(time.Time); ok {
-					err := ts.UnmarshalBinary(bin)
-
-					if err != nil {
-						return err
-					}
-
-					fieldVal.Set(reflect.ValueOf(ts))
-					done = true
-				}
-			}
-
-			if !done {
-
-				if subMap, ok := data.Maps[registerName]; ok {
-					// Struct
-					newPath := append(path, registerName)
+			if subMap, ok := data.Maps[registerName]; ok {
+				newPath := append(path, registerName)
 
-					err := transMapToStruct(subMap, fieldVal, fieldVal.Type(), riakContext, newPath, riakRequest)
+				err := transMapToStruct(subMap, fieldVal, fieldVal.Type(), riakContext, newPath, riakRequest)
 
-					if err != nil {
-						return err
-					}
+				if err != nil {
+					return err
 				}
 			}
 
@@ -205,11 +223,11 @@ func transMapToStruct(data *riak.Map, rValue reflect.Value, rType reflect.Type,
 				fieldVal.Set(reflect.ValueOf(resRegister))
 
 			default:
-				return errors.New("Unexpected ptr type: " + fieldVal.Type().String())
+				return newUnsupportedTypeError(append(path, registerName), field.Type, "Unexpected ptr type: "+fieldVal.Type().String())
 			}
 
 		default:
-			return errors.New("Unknown type: " + field.Type.Kind().String())
+			return newUnsupportedTypeError(append(path, registerName), field.Type, "Unknown type: "+field.Type.Kind().String())
 		}
 	}
 
@@ -217,40 +235,49 @@ func transMapToStruct(data *riak.Map, rValue reflect.Value, rType reflect.Type,
 }
 
 // Converts Riak objects (can be either Sets or Registers) to Golang Slices
-func transRiakToSlice(sliceValue reflect.Value, registerName string, data *riak.Map) error {
+func transRiakToSlice(sliceValue reflect.Value, registerName string, data *riak.Map, path []string) error {
 
-	switch sliceValue.Type().Elem().Kind() {
+	elemType := sliceValue.Type().Elem()
 
-	// []int
-	case reflect.Int:
+	// Types with their own unmarshaler, numbers, bools, strings and pointers to byte types are saved as Sets
+	if isRegisterUnmarshaler(elemType) || isSetItemKind(elemType.Kind()) || (elemType.Kind() == reflect.Ptr && isBytesType(elemType)) {
 		if setVal, ok := data.Sets[registerName]; ok {
-			result := make([]int, len(setVal))
+			result := reflect.MakeSlice(sliceValue.Type(), len(setVal), len(setVal))
 
 			for i, v := range setVal {
-				intVal, err := strconv.ParseInt(string(v), 10, 64)
+				item, err := setItemToValue(v, elemType, append(path, registerName))
 
 				if err != nil {
 					return err
 				}
 
-				result[i] = int(intVal)
+				result.Index(i).Set(item)
 			}
 
 			// Success!
-			sliceValue.Set(reflect.ValueOf(result))
+			sliceValue.Set(result)
 		}
 
-	// []string
-	case reflect.String:
+		return nil
+	}
+
+	switch elemType.Kind() {
+
+	// []struct, saved as JSON
+	case reflect.Struct:
 		if setVal, ok := data.Sets[registerName]; ok {
-			result := make([]string, len(setVal))
+			result := reflect.MakeSlice(sliceValue.Type(), len(setVal), len(setVal))
 
 			for i, v := range setVal {
-				result[i] = string(v)
+				err := json.Unmarshal(v, result.Index(i).Addr().Interface())
+
+				if err != nil {
+					return err
+				}
 			}
 
 			// Success!
-			sliceValue.Set(reflect.ValueOf(result))
+			sliceValue.Set(result)
 		}
 
 	// []byte
@@ -263,14 +290,21 @@ func transRiakToSlice(sliceValue reflect.Value, registerName string, data *riak.
 	case reflect.Slice:
 
 		if sliceValue.Type().Elem().Elem().Kind() == reflect.Uint8 {
-			if val, ok := data.Sets[registerName]; ok {
-				sliceValue.Set(reflect.ValueOf(val))
+			if values, ok := data.Sets[registerName]; ok {
+				result := reflect.MakeSlice(sliceValue.Type(), len(values), len(values))
+
+				// Convert to named types, such as net.IP
+				for i, value := range values {
+					result.Index(i).Set(reflect.ValueOf(value).Convert(elemType))
+				}
+
+				sliceValue.Set(result)
 			}
 
 			return nil
 		}
 
-		return errors.New("Unknown slice slice type: " + sliceValue.Type().Elem().Elem().Kind().String())
+		return newUnsupportedTypeError(append(path, registerName), sliceValue.Type(), "Unknown slice slice type: "+sliceValue.Type().Elem().Elem().Kind().String())
 
 	// [][n]byte
 	case reflect.Array:
@@ -288,6 +322,9 @@ func transRiakToSlice(sliceValue reflect.Value, registerName string, data *riak.
 				finalSliceValue := reflect.MakeSlice(sliceType, len(values), len(values))
 
 				for valueIndex, value := range values {
+					if len(value) != lengthOfExpectedArray {
+						return newArrayLengthError(append(path, registerName), arrayType, len(value))
+					}
 
 					// Create the array from Riak data
 					newArray := reflect.New(arrayType).Elem()
@@ -307,16 +344,16 @@ func transRiakToSlice(sliceValue reflect.Value, registerName string, data *riak.
 			return nil
 		}
 
-		return errors.New("Unknown slice array type: " + sliceValue.Type().Elem().Elem().Kind().String())
+		return newUnsupportedTypeError(append(path, registerName), sliceValue.Type(), "Unknown slice array type: "+sliceValue.Type().Elem().Elem().Kind().String())
 
 	default:
-		return errors.New("Unknown slice type: " + sliceValue.Type().Elem().Kind().String())
+		return newUnsupportedTypeError(append(path, registerName), sliceValue.Type(), "Unknown slice type: "+sliceValue.Type().Elem().Kind().String())
 	}
 
 	return nil
 }
 
-func bytesToValue(input []byte, outputType reflect.Type) (reflect.Value, error) {
+func bytesToValue(input []byte, outputType reflect.Type, path []string) (reflect.Value, error) {
 
 	outputKind := outputType.Kind()
 
@@ -329,71 +366,91 @@ func bytesToValue(input []byte, outputType reflect.Type) (reflect.Value, error)
 		return newWithSameType, nil
 
 	case reflect.Int:
-		if i, err := strconv.ParseInt(string(input), 10, 0); err == nil {
-			newWithSameType.SetInt(i)
-			return newWithSameType, nil
-		}
-
+		fallthrough
 	case reflect.Int8:
-		if i, err := strconv.ParseInt(string(input), 10, 8); err == nil {
-			newWithSameType.SetInt(i)
-			return newWithSameType, nil
-		}
-
+		fallthrough
 	case reflect.Int16:
-		if i, err := strconv.ParseInt(string(input), 10, 16); err == nil {
-			newWithSameType.SetInt(i)
-			return newWithSameType, nil
-		}
-
+		fallthrough
 	case reflect.Int32:
-		if i, err := strconv.ParseInt(string(input), 10, 32); err == nil {
-			newWithSameType.SetInt(i)
-			return newWithSameType, nil
-		}
-
+		fallthrough
 	case reflect.Int64:
-		if i, err := strconv.ParseInt(string(input), 10, 64); err == nil {
-			newWithSameType.SetInt(i)
-			return newWithSameType, nil
+		i, err := strconv.ParseInt(string(input), 10, outputType.Bits())
+		if err != nil {
+			return reflect.Value{}, wrapUnsupportedTypeError(path, outputType, err)
 		}
 
-	case reflect.Uint:
-		if i, err := strconv.ParseUint(string(input), 10, 0); err == nil {
-			newWithSameType.SetUint(i)
-			return newWithSameType, nil
-		}
+		newWithSameType.SetInt(i)
+		return newWithSameType, nil
 
+	case reflect.Uint:
+		fallthrough
 	case reflect.Uint8:
-		if i, err := strconv.ParseUint(string(input), 10, 8); err == nil {
-			newWithSameType.SetUint(i)
-			return newWithSameType, nil
+		fallthrough
+	case reflect.Uint16:
+		fallthrough
+	case reflect.Uint32:
+		fallthrough
+	case reflect.Uint64:
+		i, err := strconv.ParseUint(string(input), 10, outputType.Bits())
+		if err != nil {
+			return reflect.Value{}, wrapUnsupportedTypeError(path, outputType, err)
 		}
 
-	case reflect.Uint16:
-		if i, err := strconv.ParseUint(string(input), 10, 16); err == nil {
-			newWithSameType.SetUint(i)
-			return newWithSameType, nil
+		newWithSameType.SetUint(i)
+		return newWithSameType, nil
+
+	case reflect.Float32:
+		fallthrough
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(string(input), outputType.Bits())
+		if err != nil {
+			return reflect.Value{}, wrapUnsupportedTypeError(path, outputType, err)
 		}
 
-	case reflect.Uint32:
-		if i, err := strconv.ParseUint(string(input), 10, 32); err == nil {
-			newWithSameType.SetUint(i)
-			return newWithSameType, nil
+		newWithSameType.SetFloat(f)
+		return newWithSameType, nil
+
+	case reflect.Complex64:
+		fallthrough
+	case reflect.Complex128:
+		c, err := strconv.ParseComplex(string(input), outputType.Bits())
+		if err != nil {
+			return reflect.Value{}, wrapUnsupportedTypeError(path, outputType, err)
 		}
 
-	case reflect.Uint64:
-		if i, err := strconv.ParseUint(string(input), 10, 64); err == nil {
-			newWithSameType.SetUint(i)
-			return newWithSameType, nil
+		newWithSameType.SetComplex(c)
+		return newWithSameType, nil
+
+	case reflect.Bool:
+		b, err := strconv.ParseBool(string(input))
+		if err != nil {
+			return reflect.Value{}, wrapUnsupportedTypeError(path, outputType, err)
 		}
 
+		newWithSameType.SetBool(b)
+		return newWithSameType, nil
+
 	case reflect.Slice:
 		sliceItemType := outputType.Elem().Kind()
 
 		switch sliceItemType {
 		case reflect.Uint8:
-			return reflect.ValueOf(input), nil
+			// Convert to named types, such as net.IP
+			return reflect.ValueOf(input).Convert(outputType), nil
+		}
+
+	// Pointers to []byte and [N]byte types
+	case reflect.Ptr:
+		if isBytesType(outputType) {
+			val, err := bytesToValue(input, outputType.Elem(), path)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+
+			ptr := reflect.New(outputType.Elem())
+			ptr.Elem().Set(val)
+
+			return ptr, nil
 		}
 
 	case reflect.Array:
@@ -406,6 +463,9 @@ func bytesToValue(input []byte, outputType reflect.Type) (reflect.Value, error)
 		switch arrayItemType {
 		// Byte array
 		case reflect.Uint8:
+			if len(input) != lengthOfExpectedArray {
+				return reflect.Value{}, newArrayLengthError(path, outputType, len(input))
+			}
 
 			// Copy bytes
 			for i := 0; i < lengthOfExpectedArray; i++ {
@@ -416,11 +476,25 @@ func bytesToValue(input []byte, outputType reflect.Type) (reflect.Value, error)
 		}
 	}
 
-	return reflect.ValueOf(nil), errors.New("Invalid input type: " + outputType.String())
+	return reflect.Value{}, newUnsupportedTypeError(path, outputType, "Invalid input type: "+outputType.String())
+}
+
+// newArrayLengthError returns an error for a value that does not have the same length as the array it is read to
+func newArrayLengthError(path []string, arrayType reflect.Type, length int) error {
+	return newUnsupportedTypeError(path, arrayType, "Invalid length "+strconv.Itoa(length)+" for "+arrayType.String()+", expected "+strconv.Itoa(arrayType.Len()))
+}
+
+// setItemToValue converts a member of a Set to an item in a slice, see setItemBytes
+func setItemToValue(input []byte, itemType reflect.Type, path []string) (reflect.Value, error) {
+	if isRegisterUnmarshaler(itemType) {
+		return unmarshalRegister(input, itemType)
+	}
+
+	return bytesToValue(input, itemType, path)
 }
 
 // Converts a Riak Map to a Go Map
-func transMapToMap(mapValue reflect.Value, data *riak.Map) error {
+func transMapToMap(mapValue reflect.Value, data *riak.Map, riakContext []byte, path []string, riakRequest requestData) error {
 
 	mapKeyType := mapValue.Type().Key().Kind()
 
@@ -428,19 +502,58 @@ func transMapToMap(mapValue reflect.Value, data *riak.Map) error {
 	newMap := reflect.MakeMap(mapValue.Type())
 	mapValue.Set(newMap)
 
+	elemType := mapValue.Type().Elem()
+
+	// Structs are saved as Maps
+	if (elemType.Kind() == reflect.Struct && !isRegisterUnmarshaler(elemType)) || pointerType(elemType).Implements(riakMapUnmarshalerType) {
+		for key, subMap := range data.Maps {
+			keyValue, err := bytesToValue([]byte(key), mapValue.Type().Key(), path)
+
+			if err != nil {
+				return newUnsupportedTypeError(path, mapValue.Type(), "Unknown map key type: "+mapKeyType.String())
+			}
+
+			valValue := reflect.New(elemType).Elem()
+
+			if unmarshaler, ok := valValue.Addr().Interface().(RiakMapUnmarshaler); ok {
+				err = unmarshaler.UnmarshalRiakMap(subMap)
+			} else {
+				err = transMapToStruct(subMap, valValue, elemType, riakContext, append(append([]string{}, path...), key), riakRequest)
+			}
+
+			if err != nil {
+				return err
+			}
+
+			mapValue.SetMapIndex(keyValue, valValue)
+		}
+
+		return nil
+	}
+
 	for key, val := range data.Registers {
 
 		// Convert key (a string) to the correct reflect.Value
-		keyValue, err := bytesToValue([]byte(key), mapValue.Type().Key())
+		keyValue, err := bytesToValue([]byte(key), mapValue.Type().Key(), path)
 
 		if err != nil {
-			return errors.New("Unknown map key type: " + mapKeyType.String())
+			return newUnsupportedTypeError(path, mapValue.Type(), "Unknown map key type: "+mapKeyType.String())
 		}
 
-		valValue, err := bytesToValue(val, mapValue.Type().Elem())
+		var valValue reflect.Value
 
-		if err != nil {
-			return errors.New("Unknown map value type")
+		if isRegisterUnmarshaler(mapValue.Type().Elem()) {
+			valValue, err = unmarshalRegister(val, mapValue.Type().Elem())
+
+			if err != nil {
+				return err
+			}
+		} else {
+			valValue, err = bytesToValue(val, mapValue.Type().Elem(), append(path, key))
+
+			if err != nil {
+				return newUnsupportedTypeError(append(path, key), mapValue.Type(), "Unknown map value type")
+			}
 		}
 
 		// Save value to the Go map
@@ -449,3 +562,57 @@ func transMapToMap(mapValue reflect.Value, data *riak.Map) error {
 
 	return nil
 }
+
+// Converts a Riak Map with a nested Map for each item to a slice of structs, see encodeKeyedSlice.
+// The items are ordered by key.
+func transMapToKeyedSlice(sliceValue reflect.Value, registerName string, keyField string, data *riak.Map, riakContext []byte, path []string, riakRequest requestData) error {
+	itemType, keyIndex, err := keyedSliceType(sliceValue.Type(), keyField, append(path, registerName))
+
+	if err != nil {
+		return err
+	}
+
+	subMap, ok := data.Maps[registerName]
+	if !ok {
+		return nil
+	}
+
+	keys := make([]string, 0, len(subMap.Maps))
+	for key := range subMap.Maps {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	result := reflect.MakeSlice(sliceValue.Type(), len(keys), len(keys))
+
+	for i, key := range keys {
+		item := result.Index(i)
+		itemPath := append(append([]string{}, path...), registerName, key)
+
+		err := transMapToStruct(subMap.Maps[key], item, itemType, riakContext, itemPath, riakRequest)
+
+		if err != nil {
+			return err
+		}
+
+		// The key is always available, even if the field itself is not saved
+		keyFieldVal := item.FieldByIndex(keyIndex)
+
+		if !keyFieldVal.CanSet() {
+			continue
+		}
+
+		keyValue, err := bytesToValue([]byte(key), keyFieldVal.Type(), itemPath)
+
+		if err != nil {
+			return newUnsupportedTypeError(itemPath, itemType, "Unknown goriakkey field type: "+keyFieldVal.Kind().String())
+		}
+
+		keyFieldVal.Set(keyValue)
+	}
+
+	sliceValue.Set(result)
+
+	return nil
+}
@@ -0,0 +1,191 @@
+package goriak
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testAudit struct {
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type testOwner struct {
+	Owner string
+	Name  string
+}
+
+// TestEmbeddedOwner is exported, pointers to unexported embedded types can not be allocated when reading
+type TestEmbeddedOwner struct {
+	Owner string
+}
+
+func TestAutoMapEmbedded(t *testing.T) {
+	type document struct {
+		testAudit
+		*TestEmbeddedOwner
+		Title string
+	}
+
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	val := document{
+		testAudit: testAudit{
+			CreatedAt: created,
+			UpdatedAt: created.Add(time.Hour),
+		},
+		TestEmbeddedOwner: &TestEmbeddedOwner{Owner: "zegl"},
+		Title:             "Hello",
+	}
+
+	result, err := bucket().Set(val).Run(con())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var res document
+	_, err = bucket().Get(result.Key, &res).Run(con())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !reflect.DeepEqual(val, res) {
+		t.Errorf("values are not equal:\n%+v\n%+v", val, res)
+	}
+
+	// The fields are saved in the parent map
+	type flatType struct {
+		CreatedAt time.Time
+		Owner     string
+		Title     string
+	}
+
+	var flat flatType
+	_, err = bucket().Get(result.Key, &flat).Run(con())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !flat.CreatedAt.Equal(created) || flat.Owner != "zegl" || flat.Title != "Hello" {
+		t.Errorf("unexpected flat values: %+v", flat)
+	}
+
+	// Nil embedded pointers are not saved
+	result, err = bucket().Set(document{Title: "No owner"}).Run(con())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	res = document{}
+	_, err = bucket().Get(result.Key, &res).Run(con())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res.Title != "No owner" || res.TestEmbeddedOwner == nil || res.Owner != "" {
+		t.Errorf("unexpected values: %+v", res)
+	}
+}
+
+func TestAutoMapEmbeddedTagged(t *testing.T) {
+	type document struct {
+		testAudit `goriak:"audit"`
+		Title     string
+	}
+
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	result, err := bucket().Set(document{
+		testAudit: testAudit{CreatedAt: created},
+		Title:     "Hello",
+	}).Run(con())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// The tag opts in to a nested map
+	type nestedType struct {
+		Audit struct {
+			CreatedAt time.Time
+		} `goriak:"audit"`
+		CreatedAt time.Time
+	}
+
+	var nested nestedType
+	_, err = bucket().Get(result.Key, &nested).Run(con())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !nested.Audit.CreatedAt.Equal(created) || !nested.CreatedAt.IsZero() {
+		t.Errorf("unexpected values: %+v", nested)
+	}
+
+	var res document
+	_, err = bucket().Get(result.Key, &res).Run(con())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !res.CreatedAt.Equal(created) || res.Title != "Hello" {
+		t.Errorf("unexpected values: %+v", res)
+	}
+}
+
+func TestMapFieldsConflicts(t *testing.T) {
+	type other struct {
+		Name  string
+		Owner string
+	}
+
+	type tagged struct {
+		Owner string `goriak:"Owner"`
+	}
+
+	type document struct {
+		testOwner
+		other
+		tagged
+		Name string
+	}
+
+	var names []string
+	for _, field := range mapFields(reflect.TypeOf(document{})) {
+		names = append(names, field.name)
+	}
+
+	// Name is shadowed by the field in document.
+	// Owner exists in three embedded structs, and the tagged field is used.
+	if !reflect.DeepEqual(names, []string{"Owner", "Name"}) {
+		t.Error("unexpected fields:", names)
+	}
+
+	fields := mapFields(reflect.TypeOf(document{}))
+	if !reflect.DeepEqual(fields[0].Index, []int{2, 0}) || !reflect.DeepEqual(fields[1].Index, []int{3}) {
+		t.Errorf("unexpected fields: %+v", fields)
+	}
+
+	type conflict struct {
+		testOwner
+		other
+	}
+
+	names = nil
+	for _, field := range mapFields(reflect.TypeOf(conflict{})) {
+		names = append(names, field.name)
+	}
+
+	// Fields with the same name and depth are ignored
+	if len(names) != 0 {
+		t.Error("unexpected fields:", names)
+	}
+}
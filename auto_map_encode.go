@@ -1,26 +1,27 @@
 package goriak
 
 import (
-	"errors"
+	"encoding/json"
 	"reflect"
 	"strconv"
-	"time"
 )
 
 type mapEncoder struct {
 	isModifyable bool
-	riakRequest  requestData
+
+	// helpers initializes the nil Counter, Set, Flag and Register fields of the input
+	helpers []func(riakRequest requestData)
 }
 
-func encodeInterface(input interface{}, riakRequest requestData) ([]byte, *riakMapOperation, error) {
-	op := &riakMapOperation{}
+// encodeInterface converts input to a map operation. The input is not modified, initHelpers initializes the nil
+// Counter, Set, Flag and Register fields of input (if it is a pointer), and is called after the value has been saved.
+func encodeInterface(input interface{}) (riakContext []byte, op *riakMapOperation, initHelpers func(riakRequest requestData), err error) {
+	op = &riakMapOperation{}
 
 	var rValue reflect.Value
 
 	// Initialize encoder
-	encoder := &mapEncoder{
-		riakRequest: riakRequest,
-	}
+	encoder := &mapEncoder{}
 
 	if reflect.ValueOf(input).Kind() == reflect.Struct {
 		rValue = reflect.ValueOf(input)
@@ -28,47 +29,73 @@ func encodeInterface(input interface{}, riakRequest requestData) ([]byte, *riakM
 		rValue = reflect.ValueOf(input).Elem()
 		encoder.isModifyable = true
 	} else {
-		return []byte{}, nil, errors.New("Could not parse value. Needs to be struct or pointer to struct")
+		return []byte{}, nil, nil, newUnsupportedTypeError(nil, reflect.TypeOf(input), "Could not parse value. Needs to be struct or pointer to struct")
 	}
 
-	riakContext, err := encoder.encodeStruct(rValue, op, []string{})
+	riakContext, err = encoder.encodeStruct(rValue, op, []string{})
 
 	if err != nil {
-		return []byte{}, nil, err
+		return []byte{}, nil, nil, err
+	}
+
+	initHelpers = func(riakRequest requestData) {
+		for _, init := range encoder.helpers {
+			init(riakRequest)
+		}
 	}
 
-	return riakContext, op, nil
+	return riakContext, op, initHelpers, nil
 }
 
-func (e *mapEncoder) encodeStruct(rValue reflect.Value, op *riakMapOperation, path []string) ([]byte, error) {
-	rType := rValue.Type()
+// addHelper initializes f with the helper returned by newHelper, when the helpers are initialized
+func (e *mapEncoder) addHelper(f reflect.Value, itemKey string, path []string, newHelper func(h helper) interface{}) {
+	path = append([]string{}, path...)
 
-	num := rType.NumField()
+	e.helpers = append(e.helpers, func(riakRequest requestData) {
+		// The field could have been set by the caller after the value was saved
+		if !f.IsNil() {
+			return
+		}
+
+		f.Set(reflect.ValueOf(newHelper(helper{
+			name: itemKey,
+			path: path,
+			key:  riakRequest,
+		})))
+	})
+}
 
+func (e *mapEncoder) encodeStruct(rValue reflect.Value, op *riakMapOperation, path []string) ([]byte, error) {
 	riakContext := []byte{}
 
-	for i := 0; i < num; i++ {
-		field := rType.Field(i)
+	// Fields in embedded structs are saved in the same map, see mapFields
+	for _, field := range mapFields(rValue.Type()) {
+		fieldVal, ok := fieldByIndex(rValue, field.Index)
 
-		itemKey := field.Name
+		// Fields in nil embedded pointers are not saved
+		if !ok {
+			continue
+		}
 
-		tag := field.Tag.Get("goriak")
+		itemKey := field.name
 
-		if len(tag) > 0 {
-			itemKey = tag
+		// Use as context
+		if field.Tag.Get("goriak") == "goriakcontext" {
+			riakContext = fieldVal.Bytes()
+		}
 
-			// Use as context
-			if tag == "goriakcontext" {
-				riakContext = rValue.Field(i).Bytes()
-			}
+		// Slices of structs saved as a map, keyed by a field in the struct
+		if keyField := field.Tag.Get("goriakkey"); len(keyField) > 0 {
+			err := e.encodeKeyedSlice(op, itemKey, fieldVal, keyField, path)
 
-			// Ignore. Do not save this value.
-			if tag == "-" {
-				continue
+			if err != nil {
+				return []byte{}, err
 			}
+
+			continue
 		}
 
-		err := e.encodeValue(op, itemKey, rValue.Field(i), path)
+		err := e.encodeValue(op, itemKey, fieldVal, path)
 
 		if err != nil {
 			return []byte{}, err
@@ -79,6 +106,21 @@ func (e *mapEncoder) encodeStruct(rValue reflect.Value, op *riakMapOperation, pa
 }
 
 func (e *mapEncoder) encodeValue(op *riakMapOperation, itemKey string, f reflect.Value, path []string) error {
+
+	// Types with their own marshaler, such as time.Time
+	if done, err := e.encodeMarshaler(op, itemKey, f, path); done {
+		return err
+	}
+
+	// Pointers to []byte and [N]byte types are saved as the value, nil pointers are not saved
+	if f.Kind() == reflect.Ptr && isBytesType(f.Type()) {
+		if f.IsNil() {
+			return nil
+		}
+
+		return e.encodeValue(op, itemKey, f.Elem(), path)
+	}
+
 	switch f.Kind() {
 
 	// Ints are saved as Registers
@@ -105,6 +147,17 @@ func (e *mapEncoder) encodeValue(op *riakMapOperation, itemKey string, f reflect
 	case reflect.Uint64:
 		op.SetRegister(itemKey, []byte(strconv.FormatUint(f.Uint(), 10)))
 
+	// Floats and complex numbers are saved as Registers
+	case reflect.Float32:
+		fallthrough
+	case reflect.Float64:
+		op.SetRegister(itemKey, []byte(formatFloat(f)))
+
+	case reflect.Complex64:
+		fallthrough
+	case reflect.Complex128:
+		op.SetRegister(itemKey, []byte(formatComplex(f)))
+
 	// Strings are saved as Registers
 	case reflect.String:
 		op.SetRegister(itemKey, []byte(f.String()))
@@ -115,7 +168,7 @@ func (e *mapEncoder) encodeValue(op *riakMapOperation, itemKey string, f reflect
 
 	// Arrays are saved as Registers
 	case reflect.Array:
-		err := e.encodeArray(op, itemKey, f)
+		err := e.encodeArray(op, itemKey, f, path)
 
 		if err != nil {
 			return err
@@ -124,7 +177,7 @@ func (e *mapEncoder) encodeValue(op *riakMapOperation, itemKey string, f reflect
 	// Slices are saved as Sets
 	// []byte and []uint8 are saved as Registers
 	case reflect.Slice:
-		err := e.encodeSlice(op, itemKey, f)
+		err := e.encodeSlice(op, itemKey, f, path)
 
 		if err != nil {
 			return err
@@ -142,31 +195,15 @@ func (e *mapEncoder) encodeValue(op *riakMapOperation, itemKey string, f reflect
 		}
 
 	case reflect.Struct:
+		subOp := op.Map(itemKey)
 
-		done := false
-
-		if ts, ok := f.Interface().(time.Time); ok {
-			bin, err := ts.MarshalBinary()
-
-			if err != nil {
-				return err
-			}
-
-			op.SetRegister(itemKey, bin)
-			done = true
-		}
-
-		if !done {
-			subOp := op.Map(itemKey)
-
-			subPath := path
-			subPath = append(subPath, itemKey)
+		subPath := path
+		subPath = append(subPath, itemKey)
 
-			_, err := e.encodeStruct(f, subOp, subPath)
+		_, err := e.encodeStruct(f, subOp, subPath)
 
-			if err != nil {
-				return err
-			}
+		if err != nil {
+			return err
 		}
 
 	case reflect.Ptr:
@@ -180,18 +217,9 @@ func (e *mapEncoder) encodeValue(op *riakMapOperation, itemKey string, f reflect
 
 				// Initialize counter if Set() was given a struct pointer
 				if e.isModifyable {
-					resCounter := &Counter{
-						helper: helper{
-							name: itemKey,
-							path: path,
-							key:  e.riakRequest,
-							//context: riakContext,
-						},
-
-						val: 0,
-					}
-
-					f.Set(reflect.ValueOf(resCounter))
+					e.addHelper(f, itemKey, path, func(h helper) interface{} {
+						return &Counter{helper: h, val: 0}
+					})
 				}
 
 				return nil
@@ -208,18 +236,11 @@ func (e *mapEncoder) encodeValue(op *riakMapOperation, itemKey string, f reflect
 
 			// Add an empty item
 			if f.IsNil() {
-				// Initialize counter if Set() was given a struct pointer
+				// Initialize set if Set() was given a struct pointer
 				if e.isModifyable {
-					resSet := &Set{
-						helper: helper{
-							name: itemKey,
-							path: path,
-							key:  e.riakRequest,
-							//context: riakContext,
-						},
-					}
-
-					f.Set(reflect.ValueOf(resSet))
+					e.addHelper(f, itemKey, path, func(h helper) interface{} {
+						return &Set{helper: h}
+					})
 				}
 
 				return nil
@@ -246,18 +267,10 @@ func (e *mapEncoder) encodeValue(op *riakMapOperation, itemKey string, f reflect
 
 				// Initialize flag if Flag() was given a struct pointer
 				if e.isModifyable {
-					resFlag := &Flag{
-						helper: helper{
-							name: itemKey,
-							path: path,
-							key:  e.riakRequest,
-						},
-
+					e.addHelper(f, itemKey, path, func(h helper) interface{} {
 						// Initialize to false
-						val: false,
-					}
-
-					f.Set(reflect.ValueOf(resFlag))
+						return &Flag{helper: h, val: false}
+					})
 				}
 
 				return nil
@@ -279,15 +292,9 @@ func (e *mapEncoder) encodeValue(op *riakMapOperation, itemKey string, f reflect
 
 				// Initialize flag if Flag() was given a struct pointer
 				if e.isModifyable {
-					resRegister := &Register{
-						helper: helper{
-							name: itemKey,
-							path: path,
-							key:  e.riakRequest,
-						},
-					}
-
-					f.Set(reflect.ValueOf(resRegister))
+					e.addHelper(f, itemKey, path, func(h helper) interface{} {
+						return &Register{helper: h}
+					})
 				}
 
 				return nil
@@ -301,17 +308,17 @@ func (e *mapEncoder) encodeValue(op *riakMapOperation, itemKey string, f reflect
 			return nil
 		}
 
-		return errors.New("Unexpected ptr type: " + f.Type().String())
+		return newUnsupportedTypeError(append(path, itemKey), f.Type(), "Unexpected ptr type: "+f.Type().String())
 
 	default:
-		return errors.New("Unexpected type: " + f.Kind().String())
+		return newUnsupportedTypeError(append(path, itemKey), f.Type(), "Unexpected type: "+f.Kind().String())
 	}
 
 	return nil
 }
 
 // Arrays are saved as Registers
-func (e *mapEncoder) encodeArray(op *riakMapOperation, itemKey string, f reflect.Value) error {
+func (e *mapEncoder) encodeArray(op *riakMapOperation, itemKey string, f reflect.Value, path []string) error {
 
 	// Empty
 	if f.Len() == 0 {
@@ -332,39 +339,59 @@ func (e *mapEncoder) encodeArray(op *riakMapOperation, itemKey string, f reflect
 		return nil
 	}
 
-	return errors.New("Unknown Array type: " + f.Index(0).Kind().String())
+	return newUnsupportedTypeError(append(path, itemKey), f.Type(), "Unknown Array type: "+f.Index(0).Kind().String())
 }
 
 // Slices are saved as Sets
 // []byte and []uint8 are saved as Registers
-func (e *mapEncoder) encodeSlice(op *riakMapOperation, itemKey string, f reflect.Value) error {
+func (e *mapEncoder) encodeSlice(op *riakMapOperation, itemKey string, f reflect.Value, path []string) error {
 	sliceType := f.Type().Elem().Kind()
 	sliceLength := f.Len()
 	sliceVal := f.Slice(0, sliceLength)
 
-	switch sliceType {
-	case reflect.Int:
+	// Types with their own marshaler, numbers, bools, strings and pointers to byte types are saved as Sets
+	if isRegisterMarshaler(f.Type().Elem()) || isSetItemKind(sliceType) || (sliceType == reflect.Ptr && isBytesType(f.Type().Elem())) {
+		if !f.CanInterface() {
+			return newUnsupportedTypeError(append(path, itemKey), f.Type(), "Unexported slice")
+		}
 
-		// Convert Int -> String -> []byte
 		for ii := 0; ii < sliceLength; ii++ {
-			intVal := sliceVal.Index(ii).Int()
-			strVal := strconv.FormatInt(intVal, 10)
-			op.AddToSet(itemKey, []byte(strVal))
-		}
+			item, ok, err := setItemBytes(sliceVal.Index(ii))
 
-	case reflect.String:
+			if err != nil {
+				return err
+			}
 
-		// Convert String -> []byte
-		for ii := 0; ii < sliceLength; ii++ {
-			strVal := sliceVal.Index(ii).String()
-			op.AddToSet(itemKey, []byte(strVal))
+			if ok {
+				op.AddToSet(itemKey, item)
+			}
 		}
 
+		return nil
+	}
+
+	switch sliceType {
 	case reflect.Uint8:
 
 		// Uint8 is the same as byte, store the value directly
 		op.SetRegister(itemKey, sliceVal.Bytes())
 
+	// Structs are saved as JSON
+	case reflect.Struct:
+		if !f.CanInterface() {
+			return newUnsupportedTypeError(append(path, itemKey), f.Type(), "Unexported slice of structs")
+		}
+
+		for ii := 0; ii < sliceLength; ii++ {
+			item, err := json.Marshal(sliceVal.Index(ii).Interface())
+
+			if err != nil {
+				return err
+			}
+
+			op.AddToSet(itemKey, item)
+		}
+
 	case reflect.Array:
 
 		// [n]byte
@@ -402,10 +429,10 @@ func (e *mapEncoder) encodeSlice(op *riakMapOperation, itemKey string, f reflect
 			return nil
 		}
 
-		return errors.New("Unknown slice slice type: " + sliceVal.Type().Elem().Elem().Kind().String())
+		return newUnsupportedTypeError(append(path, itemKey), f.Type(), "Unknown slice slice type: "+sliceVal.Type().Elem().Elem().Kind().String())
 
 	default:
-		return errors.New("Unknown slice type: " + sliceType.String())
+		return newUnsupportedTypeError(append(path, itemKey), f.Type(), "Unknown slice type: "+sliceType.String())
 	}
 
 	return nil
@@ -430,23 +457,9 @@ func (e *mapEncoder) encodeMap(op *riakMapOperation, itemKey string, f reflect.V
 	for _, key := range keys {
 
 		// Convert the key to string
-		var keyString string
-		switch keyType {
-		case reflect.String:
-			keyString = key.String()
-
-		case reflect.Int:
-			fallthrough
-		case reflect.Int8:
-			fallthrough
-		case reflect.Int16:
-			fallthrough
-		case reflect.Int32:
-			fallthrough
-		case reflect.Int64:
-			keyString = strconv.FormatInt(int64(key.Int()), 10)
-		default:
-			return errors.New("Unknown map key type: " + keyType.String())
+		keyString, ok := mapKeyString(key)
+		if !ok {
+			return newUnsupportedTypeError(path, f.Type(), "Unknown map key type: "+keyType.String())
 		}
 
 		err := e.encodeValue(subOp, keyString, f.MapIndex(key), path)
@@ -458,3 +471,169 @@ func (e *mapEncoder) encodeMap(op *riakMapOperation, itemKey string, f reflect.V
 
 	return nil
 }
+
+// isSetItemKind returns true for the kinds that are saved as text in a Set, see setItemBytes.
+// []uint8 is not included, it is saved as a Register.
+func isSetItemKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128,
+		reflect.Bool, reflect.String:
+		return true
+	}
+
+	return false
+}
+
+// setItemBytes converts an item in a slice to a member of a Set.
+// ok is false if the item should not be saved, such as nil pointers.
+func setItemBytes(item reflect.Value) (b []byte, ok bool, err error) {
+	if isRegisterMarshaler(item.Type()) {
+		v, ok := marshalerValue(item)
+		if !ok {
+			return nil, false, nil
+		}
+
+		b, err := marshalRegister(v)
+		return b, true, err
+	}
+
+	// Raw bytes, such as net.IP
+	if isBytesType(item.Type()) {
+		if item.Kind() == reflect.Ptr {
+			if item.IsNil() {
+				return nil, false, nil
+			}
+
+			item = item.Elem()
+		}
+
+		b := make([]byte, item.Len())
+		reflect.Copy(reflect.ValueOf(b), item)
+
+		return b, true, nil
+	}
+
+	switch item.Kind() {
+	case reflect.Int:
+		fallthrough
+	case reflect.Int8:
+		fallthrough
+	case reflect.Int16:
+		fallthrough
+	case reflect.Int32:
+		fallthrough
+	case reflect.Int64:
+		return []byte(strconv.FormatInt(item.Int(), 10)), true, nil
+
+	case reflect.Uint:
+		fallthrough
+	case reflect.Uint16:
+		fallthrough
+	case reflect.Uint32:
+		fallthrough
+	case reflect.Uint64:
+		return []byte(strconv.FormatUint(item.Uint(), 10)), true, nil
+
+	case reflect.Float32:
+		fallthrough
+	case reflect.Float64:
+		return []byte(formatFloat(item)), true, nil
+
+	case reflect.Complex64:
+		fallthrough
+	case reflect.Complex128:
+		return []byte(formatComplex(item)), true, nil
+
+	case reflect.Bool:
+		return []byte(strconv.FormatBool(item.Bool())), true, nil
+
+	case reflect.String:
+		return []byte(item.String()), true, nil
+	}
+
+	return nil, false, nil
+}
+
+// mapKeyString converts a map key to the name of the item in the Riak Map.
+// ok is false if the type of the key is not supported.
+func mapKeyString(key reflect.Value) (keyString string, ok bool) {
+	switch key.Kind() {
+	case reflect.String:
+		return key.String(), true
+
+	case reflect.Int:
+		fallthrough
+	case reflect.Int8:
+		fallthrough
+	case reflect.Int16:
+		fallthrough
+	case reflect.Int32:
+		fallthrough
+	case reflect.Int64:
+		return strconv.FormatInt(key.Int(), 10), true
+
+	case reflect.Float32:
+		fallthrough
+	case reflect.Float64:
+		return formatFloat(key), true
+	}
+
+	return "", false
+}
+
+// Slices of structs with a goriakkey tag are saved as a Map with a nested Map for each item.
+// The name of the nested Map is the value of the key field.
+func (e *mapEncoder) encodeKeyedSlice(op *riakMapOperation, itemKey string, f reflect.Value, keyField string, path []string) error {
+	itemType, keyIndex, err := keyedSliceType(f.Type(), keyField, append(path, itemKey))
+
+	if err != nil {
+		return err
+	}
+
+	subOp := op.Map(itemKey)
+
+	for i := 0; i < f.Len(); i++ {
+		item := f.Index(i)
+
+		keyString, ok := mapKeyString(item.FieldByIndex(keyIndex))
+		if !ok {
+			return newUnsupportedTypeError(append(path, itemKey), itemType, "Unknown goriakkey field type: "+item.FieldByIndex(keyIndex).Kind().String())
+		}
+
+		subPath := append(append([]string{}, path...), itemKey, keyString)
+
+		_, err := e.encodeStruct(item, subOp.Map(keyString), subPath)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// keyedSliceType validates a slice with a goriakkey tag, and returns the type of the items and the index of the key field
+func keyedSliceType(sliceType reflect.Type, keyField string, path []string) (reflect.Type, []int, error) {
+	if sliceType.Kind() != reflect.Slice || sliceType.Elem().Kind() != reflect.Struct {
+		return nil, nil, newUnsupportedTypeError(path, sliceType, "goriakkey can only be used on slices of structs")
+	}
+
+	field, ok := sliceType.Elem().FieldByName(keyField)
+	if !ok {
+		return nil, nil, newUnsupportedTypeError(path, sliceType, "Unknown goriakkey field: "+keyField)
+	}
+
+	return sliceType.Elem(), field.Index, nil
+}
+
+// formatFloat formats a float32 or float64 with the shortest representation that parses back to the exact same value
+func formatFloat(f reflect.Value) string {
+	return strconv.FormatFloat(f.Float(), 'g', -1, f.Type().Bits())
+}
+
+// formatComplex is formatFloat for complex64 and complex128
+func formatComplex(f reflect.Value) string {
+	return strconv.FormatComplex(f.Complex(), 'g', -1, f.Type().Bits())
+}
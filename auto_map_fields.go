@@ -0,0 +1,178 @@
+package goriak
+
+import (
+	"reflect"
+)
+
+// mapField is a field in a struct that is saved in a Riak Map
+type mapField struct {
+	reflect.StructField
+
+	// name is the name of the item in the Riak Map
+	name string
+
+	// depth is the number of embedded structs that the field is promoted from
+	depth int
+
+	// tagged is true if the name is set with the goriak tag
+	tagged bool
+}
+
+// mapFields returns the fields of a struct that are saved in a Riak Map, with the same rules as encoding/json.
+//
+// The fields of an embedded struct (or pointer to struct) are promoted to the parent map, unless the embedded
+// field has a name set with the goriak tag, or the embedded type has its own marshaler.
+// If multiple fields have the same name, the field with the least depth is used. If there are multiple fields
+// with the least depth, the field with a goriak tag is used. Otherwise all fields with the name are ignored.
+// Fields with the tag `goriak:"-"` are always ignored. The Index of the returned fields is the full index
+// sequence, for use with FieldByIndex.
+func mapFields(t reflect.Type) []mapField {
+	var fields []mapField
+	collectMapFields(t, nil, 0, map[reflect.Type]bool{}, &fields)
+
+	// Find the dominant field for every name
+	byName := make(map[string][]int)
+	for i, field := range fields {
+		byName[field.name] = append(byName[field.name], i)
+	}
+
+	result := make([]mapField, 0, len(fields))
+
+	for i, field := range fields {
+		if dominantField(fields, byName[field.name]) == i {
+			result = append(result, field)
+		}
+	}
+
+	return result
+}
+
+// collectMapFields appends the fields of t to fields, and the fields of all embedded structs
+func collectMapFields(t reflect.Type, index []int, depth int, visited map[reflect.Type]bool, fields *[]mapField) {
+	// Recursive embedded types
+	if visited[t] {
+		return
+	}
+
+	visited[t] = true
+	defer delete(visited, t)
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("goriak")
+
+		// Ignore. Do not save this value.
+		if tag == "-" {
+			continue
+		}
+
+		field.Index = append(append([]int{}, index...), i)
+
+		if field.Anonymous && len(tag) == 0 {
+			embeddedType := field.Type
+			if embeddedType.Kind() == reflect.Ptr {
+				embeddedType = embeddedType.Elem()
+			}
+
+			if embeddedType.Kind() == reflect.Struct && !isMarshaler(embeddedType) && !isUnmarshaler(embeddedType) {
+				collectMapFields(embeddedType, field.Index, depth+1, visited, fields)
+				continue
+			}
+		}
+
+		name := field.Name
+		if len(tag) > 0 {
+			name = tag
+		}
+
+		*fields = append(*fields, mapField{
+			StructField: field,
+			name:        name,
+			depth:       depth,
+			tagged:      len(tag) > 0,
+		})
+	}
+}
+
+// dominantField returns the index of the field that is used for a name, or -1 if no field is used
+func dominantField(fields []mapField, candidates []int) int {
+	if len(candidates) == 1 {
+		return candidates[0]
+	}
+
+	minDepth := fields[candidates[0]].depth
+	for _, i := range candidates {
+		if fields[i].depth < minDepth {
+			minDepth = fields[i].depth
+		}
+	}
+
+	dominant := -1
+	count := 0
+	taggedCount := 0
+	taggedDominant := -1
+
+	for _, i := range candidates {
+		if fields[i].depth != minDepth {
+			continue
+		}
+
+		count++
+		dominant = i
+
+		if fields[i].tagged {
+			taggedCount++
+			taggedDominant = i
+		}
+	}
+
+	if count == 1 {
+		return dominant
+	}
+
+	if taggedCount == 1 {
+		return taggedDominant
+	}
+
+	return -1
+}
+
+// fieldByIndex returns the field with the index sequence from mapFields.
+// ok is false if the field is in an embedded struct pointer that is nil.
+func fieldByIndex(v reflect.Value, index []int) (field reflect.Value, ok bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+
+			v = v.Elem()
+		}
+
+		v = v.Field(x)
+	}
+
+	return v, true
+}
+
+// fieldByIndexAlloc is fieldByIndex, but allocates embedded struct pointers that are nil.
+// ok is false if a pointer can not be allocated, such as a pointer to an unexported type.
+func fieldByIndexAlloc(v reflect.Value, index []int) (field reflect.Value, ok bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, false
+				}
+
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+
+			v = v.Elem()
+		}
+
+		v = v.Field(x)
+	}
+
+	return v, true
+}
@@ -0,0 +1,93 @@
+package goriak
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+type testSetString string
+type testSetInt int16
+type testSetUint uint32
+type testSetFloat float32
+type testSetBool bool
+
+func TestAutoMapSliceTypes(t *testing.T) {
+	tests := []interface{}{
+		[]int{-1, 0, math.MaxInt32},
+		[]int8{math.MinInt8, 0, math.MaxInt8},
+		[]int16{math.MinInt16, math.MaxInt16},
+		[]int32{math.MinInt32, math.MaxInt32},
+		[]int64{math.MinInt64, math.MaxInt64},
+		[]uint{0, math.MaxUint32},
+		[]uint16{0, math.MaxUint16},
+		[]uint32{0, math.MaxUint32},
+		[]uint64{0, math.MaxUint64},
+		[]float32{-1.5, 0.1, math.MaxFloat32},
+		[]float64{-1.5, 0.1, math.SmallestNonzeroFloat64},
+		[]complex64{complex(1, -0.1)},
+		[]complex128{complex(math.Pi, math.E)},
+		[]bool{true, false},
+		[]string{"", "a", "b"},
+		[]testSetString{"x", "y"},
+		[]testSetInt{-2, 2},
+		[]testSetUint{3, 4},
+		[]testSetFloat{0.25, 0.5},
+		[]testSetBool{true},
+		[]testUUID{{0: 1}, {15: 2}},
+		[]*testUUID{{1: 3}},
+		[]testEnum{testEnumActive},
+		[]time.Time{time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)},
+	}
+
+	for _, items := range tests {
+		sliceType := reflect.TypeOf(items)
+
+		t.Run(sliceType.String(), func(t *testing.T) {
+			structType := reflect.StructOf([]reflect.StructField{
+				{Name: "Items", Type: sliceType},
+			})
+
+			val := reflect.New(structType)
+			val.Elem().Field(0).Set(reflect.ValueOf(items))
+
+			result, err := bucket().Set(val.Interface()).Run(con())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			res := reflect.New(structType)
+
+			_, err = bucket().Get(result.Key, res.Interface()).Run(con())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			// Sets are unordered
+			expected := sortedItems(reflect.ValueOf(items))
+			actual := sortedItems(res.Elem().Field(0))
+
+			if !reflect.DeepEqual(expected, actual) {
+				t.Errorf("values are not equal:\n%v\n%v", expected, actual)
+			}
+		})
+	}
+}
+
+// sortedItems returns the items of a slice as strings, in sorted order
+func sortedItems(slice reflect.Value) []string {
+	items := make([]string, slice.Len())
+
+	for i := range items {
+		items[i] = fmt.Sprintf("%T %v", slice.Index(i).Interface(), reflect.Indirect(slice.Index(i)).Interface())
+	}
+
+	sort.Strings(items)
+
+	return items
+}
@@ -1,7 +1,10 @@
 package goriak
 
 import (
+	"errors"
+	"math"
 	"reflect"
+	"sort"
 	"testing"
 )
 
@@ -232,11 +235,11 @@ func TestUnsupportedArrayType(t *testing.T) {
 
 func TestUnsupportedSliceType(t *testing.T) {
 	type testType struct {
-		A []bool
+		A []uintptr
 	}
 
 	o := testType{
-		A: []bool{false, true, true, true, false, true},
+		A: []uintptr{1, 2, 3},
 	}
 
 	_, err := bucket().Set(o).Run(con())
@@ -246,7 +249,7 @@ func TestUnsupportedSliceType(t *testing.T) {
 		return
 	}
 
-	if err.Error() != "Unknown slice type: bool" {
+	if err.Error() != "Unknown slice type: uintptr" {
 		t.Error("Unknown error")
 		t.Error(err)
 	}
@@ -312,13 +315,13 @@ func TestMapBool(t *testing.T) {
 	}
 }
 
-func TestUnknownTypeFloat(t *testing.T) {
+func TestUnknownType(t *testing.T) {
 	type ourTestType struct {
-		foo float64
+		foo uintptr
 	}
 
 	item := ourTestType{
-		foo: 12.34,
+		foo: 1234,
 	}
 
 	_, err := bucket().Set(item).Run(con())
@@ -327,12 +330,68 @@ func TestUnknownTypeFloat(t *testing.T) {
 		t.Error("Did not get error")
 	}
 
-	if err != nil && err.Error() != "Unexpected type: float64" {
+	if err != nil && err.Error() != "Unexpected type: uintptr" {
 		t.Error("Unknown error")
 		t.Error(err)
 	}
 }
 
+func TestAutoMapFloat(t *testing.T) {
+	type ourTestType struct {
+		Float32    float32
+		Float64    float64
+		Tiny       float64
+		Max        float64
+		Negative   float64
+		Inf        float64
+		Complex64  complex64
+		Complex128 complex128
+		Prices     []float64
+		Points     []complex128
+		Scores     map[string]float32
+		Labels     map[float64]string
+	}
+
+	item := ourTestType{
+		Float32:    0.1,
+		Float64:    0.30000000000000004,
+		Tiny:       math.SmallestNonzeroFloat64,
+		Max:        math.MaxFloat64,
+		Negative:   -1234.5678e-100,
+		Inf:        math.Inf(-1),
+		Complex64:  complex(1.5, -0.1),
+		Complex128: complex(math.Pi, math.E),
+		Prices:     []float64{9.99, 1e21, 1.0 / 3},
+		Points:     []complex128{complex(1, 2)},
+		Scores:     map[string]float32{"a": 3.4028235e38, "b": -0.5},
+		Labels:     map[float64]string{2.5: "two and a half", -1e-9: "tiny"},
+	}
+
+	result, err := bucket().Set(item).Run(con())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var res ourTestType
+	_, err = bucket().Get(result.Key, &res).Run(con())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(res.Prices) != len(item.Prices) {
+		t.Error("unexpected prices:", res.Prices)
+	}
+
+	// Sets are unordered
+	res.Prices = item.Prices
+
+	if !reflect.DeepEqual(item, res) {
+		t.Errorf("values are not equal:\n%+v\n%+v", item, res)
+	}
+}
+
 func TestEmptyStruct(t *testing.T) {
 	type aBunchOfTypes struct {
 		Int            int
@@ -484,7 +543,7 @@ func TestAutoMapSlices(t *testing.T) {
 
 	type readType struct {
 		A string
-		B float64
+		B uintptr
 	}
 
 	var res readType
@@ -495,7 +554,7 @@ func TestAutoMapSlices(t *testing.T) {
 		return
 	}
 
-	if err.Error() != "Unknown type: float64" {
+	if err.Error() != "Unknown type: uintptr" {
 		t.Error("Unexpected error", err)
 	}
 
@@ -541,7 +600,7 @@ func TestAutoMapSlices(t *testing.T) {
 
 	type readType4 struct {
 		A string
-		B []float64
+		B []uintptr
 	}
 
 	var res4 readType4
@@ -552,7 +611,7 @@ func TestAutoMapSlices(t *testing.T) {
 		return
 	}
 
-	if err.Error() != "Unknown slice type: float64" {
+	if err.Error() != "Unknown slice type: uintptr" {
 		t.Error("Unexpected error", err)
 	}
 
@@ -577,7 +636,7 @@ func TestAutoMapSlices(t *testing.T) {
 
 	type readType5 struct {
 		A string
-		B map[float64]float64
+		B map[bool]bool
 	}
 
 	var res5 readType5
@@ -588,7 +647,7 @@ func TestAutoMapSlices(t *testing.T) {
 		return
 	}
 
-	if err.Error() != "Unknown map key type: float64" {
+	if err.Error() != "Unknown map key type: bool" {
 		t.Error("Unexpected error", err)
 	}
 
@@ -615,7 +674,7 @@ func TestAutoMapSlices(t *testing.T) {
 	}
 
 	type readType6sub struct {
-		AA float64
+		AA uintptr
 	}
 
 	type readType6 struct {
@@ -631,7 +690,7 @@ func TestAutoMapSlices(t *testing.T) {
 		return
 	}
 
-	if err.Error() != "Unknown type: float64" {
+	if err.Error() != "Unknown type: uintptr" {
 		t.Error("Unexpected error", err)
 	}
 
@@ -656,7 +715,7 @@ func TestAutoMapSlices(t *testing.T) {
 
 	type readType7 struct {
 		A string
-		B map[string]float64
+		B map[string]bool
 	}
 
 	var res7 readType7
@@ -675,7 +734,7 @@ func TestAutoMapSlices(t *testing.T) {
 
 	type readType7b struct {
 		A string
-		B map[string][]float64
+		B map[string][]bool
 	}
 
 	var res7b readType7b
@@ -762,13 +821,13 @@ func TestAutoMapSlices(t *testing.T) {
 
 func TestEncodeErrors(t *testing.T) {
 	type writeType1 struct {
-		A map[float64]string
+		A map[bool]string
 	}
 
 	_, err := bucket().Set(writeType1{
-		A: map[float64]string{
-			2.0: "2",
-			3.0: "3",
+		A: map[bool]string{
+			true:  "2",
+			false: "3",
 		},
 	}).Run(con())
 
@@ -776,20 +835,20 @@ func TestEncodeErrors(t *testing.T) {
 		t.Error("no error")
 	}
 
-	if err.Error() != "Unknown map key type: float64" {
+	if err.Error() != "Unknown map key type: bool" {
 		t.Error("Unexpected error", err)
 	}
 
 	// ----------
 
 	type writeType2 struct {
-		A map[int]float64
+		A map[int]uintptr
 	}
 
 	_, err = bucket().Set(writeType2{
-		A: map[int]float64{
-			2: 2.0,
-			3: 3.0,
+		A: map[int]uintptr{
+			2: 2,
+			3: 3,
 		},
 	}).Run(con())
 
@@ -797,7 +856,7 @@ func TestEncodeErrors(t *testing.T) {
 		t.Error("no error")
 	}
 
-	if err.Error() != "Unexpected type: float64" {
+	if err.Error() != "Unexpected type: uintptr" {
 		t.Error("Unexpected error", err)
 	}
 
@@ -959,3 +1018,206 @@ func TestInsertAndGet(t *testing.T) {
 		t.Error("Not equal")
 	}
 }
+
+func TestAutoMapMapOfStructs(t *testing.T) {
+	type item struct {
+		Name    string
+		Tags    []string
+		Enabled bool
+	}
+
+	type ourTestType struct {
+		Items map[string]item
+		ByID  map[int]item
+	}
+
+	val := ourTestType{
+		Items: map[string]item{
+			"a": {Name: "A", Tags: []string{"x"}, Enabled: true},
+			"b": {Name: "B"},
+		},
+		ByID: map[int]item{
+			10: {Name: "ten", Tags: []string{"y", "z"}},
+		},
+	}
+
+	result, err := bucket().Set(val).Run(con())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var res ourTestType
+	_, err = bucket().Get(result.Key, &res).Run(con())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !reflect.DeepEqual(val, res) {
+		t.Errorf("values are not equal:\n%+v\n%+v", val, res)
+	}
+
+	// The path includes the name of the map
+	type errorType struct {
+		Items map[string]struct {
+			V uintptr
+		}
+	}
+
+	_, err = bucket().Set(errorType{
+		Items: map[string]struct{ V uintptr }{"a": {}},
+	}).Run(con())
+
+	var typeErr *UnsupportedTypeError
+	if !errors.As(err, &typeErr) || typeErr.Path != "Items.a.V" {
+		t.Error("unexpected error:", err)
+	}
+}
+
+func TestAutoMapSliceOfStructs(t *testing.T) {
+	type item struct {
+		Name  string `json:"name"`
+		Price float64
+	}
+
+	type ourTestType struct {
+		Items []item
+	}
+
+	val := ourTestType{
+		Items: []item{
+			{Name: "a", Price: 1.5},
+			{Name: "b", Price: 2},
+		},
+	}
+
+	result, err := bucket().Set(val).Run(con())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var res ourTestType
+	_, err = bucket().Get(result.Key, &res).Run(con())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Sets are unordered
+	sort.Slice(res.Items, func(i, j int) bool {
+		return res.Items[i].Name < res.Items[j].Name
+	})
+
+	if !reflect.DeepEqual(val, res) {
+		t.Errorf("values are not equal:\n%+v\n%+v", val, res)
+	}
+
+	// Each item is saved as JSON
+	type rawType struct {
+		Items []string
+	}
+
+	var raw rawType
+	_, err = bucket().Get(result.Key, &raw).Run(con())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	sort.Strings(raw.Items)
+
+	if !reflect.DeepEqual(raw.Items, []string{`{"name":"a","Price":1.5}`, `{"name":"b","Price":2}`}) {
+		t.Error("unexpected raw items:", raw.Items)
+	}
+}
+
+func TestAutoMapKeyedSlice(t *testing.T) {
+	type item struct {
+		ID    string `goriak:"-"`
+		Count int
+	}
+
+	type numbered struct {
+		N    int
+		Name string
+	}
+
+	type ourTestType struct {
+		Items    []item     `goriakkey:"ID"`
+		Numbered []numbered `goriak:"numbered" goriakkey:"N"`
+	}
+
+	val := ourTestType{
+		Items: []item{
+			{ID: "b", Count: 2},
+			{ID: "a", Count: 1},
+		},
+		Numbered: []numbered{
+			{N: 1, Name: "one"},
+		},
+	}
+
+	result, err := bucket().Set(val).Run(con())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var res ourTestType
+	_, err = bucket().Get(result.Key, &res).Run(con())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// The items are ordered by key
+	expected := ourTestType{
+		Items: []item{
+			{ID: "a", Count: 1},
+			{ID: "b", Count: 2},
+		},
+		Numbered: val.Numbered,
+	}
+
+	if !reflect.DeepEqual(expected, res) {
+		t.Errorf("values are not equal:\n%+v\n%+v", expected, res)
+	}
+
+	// Each item is saved as a nested map
+	type rawType struct {
+		Items map[string]struct {
+			Count int
+		}
+	}
+
+	var raw rawType
+	_, err = bucket().Get(result.Key, &raw).Run(con())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(raw.Items) != 2 || raw.Items["a"].Count != 1 || raw.Items["b"].Count != 2 {
+		t.Errorf("unexpected raw items: %+v", raw.Items)
+	}
+
+	type wrongType struct {
+		Items []string `goriakkey:"ID"`
+	}
+
+	_, err = bucket().Set(wrongType{}).Run(con())
+	if err == nil || err.Error() != "goriakkey can only be used on slices of structs" {
+		t.Error("unexpected error:", err)
+	}
+
+	type unknownField struct {
+		Items []item `goriakkey:"Name"`
+	}
+
+	_, err = bucket().Set(unknownField{}).Run(con())
+	if err == nil || err.Error() != "Unknown goriakkey field: Name" {
+		t.Error("unexpected error:", err)
+	}
+}
@@ -0,0 +1,267 @@
+package goriak
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+
+	riak "github.com/basho/riak-go-client"
+)
+
+// backend executes requests on behalf of a Session.
+// A Session created with Connect() uses Riak as the backend, a Session created
+// with NewMemorySession() keeps all data in memory.
+type backend interface {
+	execute(ctx context.Context, req request) error
+
+	// executeOnNode runs req on the node with address, instead of on a node selected by the backend
+	executeOnNode(ctx context.Context, address string, req request) error
+
+	// health returns the state of all nodes used by the backend
+	health() []NodeHealth
+
+	// addNode and removeNode adds or removes a node from the backend.
+	// The address is on the same format as ConnectOpts.Addresses.
+	addNode(address string) error
+	removeNode(address string) error
+
+	// close releases all resources held by the backend.
+	// It is called once, after all in-flight requests have finished.
+	close() error
+}
+
+// riakBackend executes requests on a Riak cluster
+type riakBackend struct {
+	cluster     *riak.Cluster
+	nodeManager *pinnedNodeManager
+
+	// Used to create new nodes
+	opts ConnectOpts
+	auth *riak.AuthOptions
+
+	// The nodes of the cluster
+	mu    sync.Mutex
+	nodes []*riakNode
+}
+
+// riakNode is a node in the cluster of a riakBackend
+type riakNode struct {
+	node    *riak.Node
+	address string
+}
+
+// execute runs req on the cluster and waits until it has finished, or until ctx is done.
+// If ctx is done first, the context error is returned and the result of req is discarded.
+func (b *riakBackend) execute(ctx context.Context, req request) error {
+	return b.executeCommand(ctx, req, nil)
+}
+
+// executeOnNode runs req on the node with address, with the connections of that node
+func (b *riakBackend) executeOnNode(ctx context.Context, address string, req request) error {
+	var node *riak.Node
+
+	b.mu.Lock()
+	for _, n := range b.nodes {
+		if n.address == address {
+			node = n.node
+		}
+	}
+	b.mu.Unlock()
+
+	if node == nil {
+		return errors.New("goriak: unknown node: " + address)
+	}
+
+	return b.executeCommand(ctx, req, node)
+}
+
+// executeCommand runs req on node, or on a node selected by the NodeManager if node is nil
+func (b *riakBackend) executeCommand(ctx context.Context, req request, node *riak.Node) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	cmd, err := req.build()
+	if err != nil {
+		return err
+	}
+
+	async := &riak.Async{
+		Command: cmd,
+		Done:    make(chan riak.Command, 1),
+	}
+
+	if node != nil {
+		async.Wait = &sync.WaitGroup{}
+		b.nodeManager.pin(cmd, node)
+	}
+
+	err = b.cluster.ExecuteAsync(async)
+
+	if node != nil {
+		// The command is unpinned when it has finished, as the cluster can retry it after ctx is done
+		go func() {
+			async.Wait.Wait()
+			b.nodeManager.unpin(cmd)
+		}()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-async.Done:
+		if async.Error != nil {
+			return newRiakError(async.Error, commandNode(cmd))
+		}
+
+		if err := cmd.Error(); err != nil {
+			return newRiakError(err, commandNode(cmd))
+		}
+
+		return req.read(cmd)
+
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// pinnedNodeManager is a riak.NodeManager that executes pinned commands on their node,
+// and all other commands on the nodes selected by next
+type pinnedNodeManager struct {
+	next riak.NodeManager
+
+	mu     sync.Mutex
+	pinned map[riak.Command]*riak.Node
+}
+
+func newPinnedNodeManager(next riak.NodeManager) *pinnedNodeManager {
+	if next == nil {
+		next = defaultNodeManager()
+	}
+
+	return &pinnedNodeManager{
+		next:   next,
+		pinned: make(map[riak.Command]*riak.Node),
+	}
+}
+
+func (m *pinnedNodeManager) ExecuteOnNode(nodes []*riak.Node, command riak.Command, previous *riak.Node) (bool, error) {
+	m.mu.Lock()
+	node, ok := m.pinned[command]
+	m.mu.Unlock()
+
+	if ok {
+		return m.next.ExecuteOnNode([]*riak.Node{node}, command, nil)
+	}
+
+	return m.next.ExecuteOnNode(nodes, command, previous)
+}
+
+// pin makes command execute on node
+func (m *pinnedNodeManager) pin(command riak.Command, node *riak.Node) {
+	m.mu.Lock()
+	m.pinned[command] = node
+	m.mu.Unlock()
+}
+
+func (m *pinnedNodeManager) unpin(command riak.Command) {
+	m.mu.Lock()
+	delete(m.pinned, command)
+	m.mu.Unlock()
+}
+
+// close stops the cluster and closes all connections to Riak
+func (b *riakBackend) close() error {
+	return b.cluster.Stop()
+}
+
+// health returns the state of all nodes in the cluster
+func (b *riakBackend) health() []NodeHealth {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	res := make([]NodeHealth, len(b.nodes))
+
+	for i, node := range b.nodes {
+		res[i] = NodeHealth{
+			Address: node.address,
+			State:   nodeState(node.node),
+		}
+	}
+
+	return res
+}
+
+// commandNode returns the address of the node that last executed cmd.
+// riak-go-client does not export the node, so it is read with reflection.
+// An empty string is returned if the node is unknown.
+func commandNode(cmd riak.Command) string {
+	v := reflect.ValueOf(cmd)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return ""
+	}
+
+	node := v.Elem().FieldByName("lastNode")
+	if !node.IsValid() || node.IsNil() {
+		return ""
+	}
+
+	return nodeAddress(node)
+}
+
+// nodeAddress returns the address of node, a reflect.Value of a *riak.Node
+func nodeAddress(node reflect.Value) string {
+	addr := node.Elem().FieldByName("addr")
+	if !addr.IsValid() || addr.IsNil() {
+		return ""
+	}
+
+	addr = addr.Elem()
+
+	tcpAddr := &net.TCPAddr{
+		IP:   append(net.IP{}, addr.FieldByName("IP").Bytes()...),
+		Port: int(addr.FieldByName("Port").Int()),
+		Zone: addr.FieldByName("Zone").String(),
+	}
+
+	return tcpAddr.String()
+}
+
+// nodeState returns the current state of node.
+// The state is not exported by riak-go-client, and is read with reflection while holding the lock of the node.
+// This depends on the layout of the Node type in riak-go-client version 5587c16e0b8b, NodeUnknown is returned
+// if the fields do not exist or have unexpected types.
+func nodeState(node *riak.Node) NodeState {
+	stateData := reflect.ValueOf(node).Elem().FieldByName("stateData")
+	if !stateData.IsValid() || stateData.Kind() != reflect.Struct {
+		return NodeUnknown
+	}
+
+	stateVal := stateData.FieldByName("stateVal")
+	if !stateVal.IsValid() || stateVal.Kind() != reflect.Uint8 {
+		return NodeUnknown
+	}
+
+	// The lock of the state is an embedded sync.RWMutex, and its methods are promoted to Node
+	mutex := stateData.FieldByName("RWMutex")
+	if !mutex.IsValid() || mutex.Type() != reflect.TypeOf(sync.RWMutex{}) {
+		return NodeUnknown
+	}
+
+	node.RLock()
+	state := stateVal.Uint()
+	node.RUnlock()
+
+	// The order of the states in riak-go-client
+	states := []NodeState{NodeCreated, NodeRunning, NodeHealthChecking, NodeShuttingDown, NodeShutdown}
+
+	if state >= uint64(len(states)) {
+		return NodeUnknown
+	}
+
+	return states[state]
+}
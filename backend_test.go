@@ -0,0 +1,57 @@
+package goriak
+
+import (
+	"testing"
+
+	riak "github.com/basho/riak-go-client"
+)
+
+func TestPinnedNodeManager(t *testing.T) {
+	if newPinnedNodeManager(nil).next == nil {
+		t.Error("no default NodeManager")
+	}
+
+	var nodes []*riak.Node
+
+	for _, address := range []string{"127.0.0.1:10017", "127.0.0.1:10027"} {
+		node, err := riak.NewNode(&riak.NodeOptions{RemoteAddress: address})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		nodes = append(nodes, node)
+	}
+
+	next := &testNodeManager{}
+	manager := newPinnedNodeManager(next)
+
+	cmd := &riak.PingCommand{}
+
+	// Pinned commands are only passed their node
+	manager.pin(cmd, nodes[1])
+	manager.ExecuteOnNode(nodes, cmd, nil)
+
+	// Other commands are passed all nodes
+	other := &riak.PingCommand{}
+	manager.ExecuteOnNode(nodes, other, nil)
+
+	manager.unpin(cmd)
+	manager.ExecuteOnNode(nodes, cmd, nil)
+
+	expected := []string{"127.0.0.1:10027", "127.0.0.1:10017", "127.0.0.1:10017"}
+
+	if len(next.executed) != len(expected) {
+		t.Fatal("unexpected executions:", next.executed)
+	}
+
+	for i, address := range expected {
+		if next.executed[i] != address {
+			t.Error("unexpected executions:", next.executed)
+		}
+	}
+
+	if len(manager.pinned) != 0 {
+		t.Error("command was not unpinned")
+	}
+}
@@ -0,0 +1,176 @@
+package goriak
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// CacheKey identifies a value in a CacheStore
+type CacheKey struct {
+	BucketType string
+	Bucket     string
+	Key        string
+}
+
+// CacheEntry is a value stored in a CacheStore
+type CacheEntry struct {
+	Value  []byte
+	VClock []byte
+}
+
+// CacheStore is the storage used by CacheMiddleware. It must be safe for concurrent use.
+type CacheStore interface {
+	// Get returns the entry for key, and false if key is not in the cache
+	Get(key CacheKey) (CacheEntry, bool)
+	Set(key CacheKey, entry CacheEntry)
+	Delete(key CacheKey)
+}
+
+// CacheMiddleware returns a read-through cache middleware for GetRaw and GetJSON.
+//
+// Values that are fetched with GetRaw and GetJSON are saved in store, and following GetRaw and GetJSON commands
+// for the same key are served from store without a request to Riak. Keys that are not found are not cached.
+// The key is removed from store when it is updated with SetRaw or SetJSON, or deleted with Delete, through a
+// session or command that uses the middleware.
+//
+// Values served from the cache are not subject to conflict resolution or the R and PR values of the command.
+//
+// If store is nil, an LRU cache with 1000 entries and a TTL of one minute is used.
+func CacheMiddleware(store CacheStore) RunMiddleware {
+	if store == nil {
+		store = NewLRUCache(defaultCacheSize, time.Minute)
+	}
+
+	return func(cmd RunMiddlewarer, next func() (*Result, error)) (*Result, error) {
+		key := CacheKey{
+			BucketType: cmd.BucketType(),
+			Bucket:     cmd.Bucket(),
+			Key:        cmd.Key(),
+		}
+
+		switch cmd.Operation() {
+		case OperationGetRaw, OperationGetJSON:
+			// The values are copied, so that the cache is not modified through the output of the command
+			if entry, ok := store.Get(key); ok {
+				return &Result{
+					Key:     key.Key,
+					Context: append([]byte(nil), entry.VClock...),
+					Value:   append([]byte(nil), entry.Value...),
+					VClock:  append([]byte(nil), entry.VClock...),
+				}, nil
+			}
+
+			res, err := next()
+			if err == nil && res != nil && !res.NotFound {
+				store.Set(key, CacheEntry{
+					Value:  append([]byte(nil), res.Value...),
+					VClock: append([]byte(nil), res.VClock...),
+				})
+			}
+
+			return res, err
+
+		case OperationSetRaw, OperationSetJSON, OperationDelete:
+			res, err := next()
+
+			// The key is also removed when the command fails, as the value could have been written
+			if key.Key != "" {
+				store.Delete(key)
+			}
+
+			return res, err
+		}
+
+		return next()
+	}
+}
+
+// defaultCacheSize is the number of entries in the LRU cache if no size is set
+const defaultCacheSize = 1000
+
+// lruCache is a CacheStore that keeps the most recently used entries
+type lruCache struct {
+	size int
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	entries map[CacheKey]*list.Element
+	order   *list.List // Most recently used first
+}
+
+type lruEntry struct {
+	key     CacheKey
+	entry   CacheEntry
+	expires time.Time
+}
+
+// NewLRUCache returns an in-memory CacheStore that keeps up to size entries. The least recently used
+// entry is removed when the cache is full. Entries expire ttl after they were added, a ttl of 0 disables expiry.
+// If size is 0 or less, the cache keeps up to 1000 entries.
+func NewLRUCache(size int, ttl time.Duration) CacheStore {
+	if size <= 0 {
+		size = defaultCacheSize
+	}
+
+	return &lruCache{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[CacheKey]*list.Element),
+		order:   list.New(),
+	}
+}
+
+func (c *lruCache) Get(key CacheKey) (CacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return CacheEntry{}, false
+	}
+
+	e := el.Value.(*lruEntry)
+
+	if c.ttl > 0 && time.Now().After(e.expires) {
+		c.remove(el)
+		return CacheEntry{}, false
+	}
+
+	c.order.MoveToFront(el)
+
+	return e.entry, true
+}
+
+func (c *lruCache) Set(key CacheKey, entry CacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+
+	c.entries[key] = c.order.PushFront(&lruEntry{
+		key:     key,
+		entry:   entry,
+		expires: time.Now().Add(c.ttl),
+	})
+
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *lruCache) Delete(key CacheKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+}
+
+func (c *lruCache) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*lruEntry).key)
+}
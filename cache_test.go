@@ -0,0 +1,176 @@
+package goriak
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCacheMiddleware(t *testing.T) {
+	store := NewLRUCache(10, time.Minute)
+
+	requests := 0
+
+	// Counts the requests that reach Riak
+	counter := func(cmd RunMiddlewarer, next func() (*Result, error)) (*Result, error) {
+		requests++
+		return next()
+	}
+
+	b := Bucket("cache", "default").
+		RegisterRunMiddleware(CacheMiddleware(store)).
+		RegisterRunMiddleware(counter)
+
+	key := randomKey()
+
+	_, err := b.SetJSON(map[string]string{"a": "b"}).Key(key).Run(con())
+	if err != nil {
+		t.Error(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		var out map[string]string
+
+		res, err := b.GetJSON(key, &out).Run(con())
+		if err != nil {
+			t.Error(err)
+		}
+
+		if out["a"] != "b" {
+			t.Error("unexpected output:", out)
+		}
+
+		if string(res.Value) != `{"a":"b"}` || len(res.VClock) == 0 {
+			t.Errorf("unexpected result: %+v", res)
+		}
+	}
+
+	// Modifying the result does not modify the cache
+	var out map[string]string
+
+	res, err := b.GetJSON(key, &out).Run(con())
+	if err != nil {
+		t.Error(err)
+	}
+
+	vclock := string(res.VClock)
+	res.VClock[0]++
+	res.Context[0]++
+
+	res, err = b.GetJSON(key, &out).Run(con())
+	if err != nil || string(res.VClock) != vclock || string(res.Context) != vclock {
+		t.Error("the cache was modified:", err)
+	}
+
+	// One SetJSON and one GetJSON
+	if requests != 2 {
+		t.Error("unexpected requests:", requests)
+	}
+
+	// Raw values are served from the same cache
+	var raw []byte
+
+	_, err = b.GetRaw(key, &raw).Run(con())
+	if err != nil || string(raw) != `{"a":"b"}` {
+		t.Error("unexpected result:", err, string(raw))
+	}
+
+	if requests != 2 {
+		t.Error("unexpected requests:", requests)
+	}
+
+	// Invalidated by SetRaw
+	_, err = b.SetRaw([]byte("hello")).Key(key).Run(con())
+	if err != nil {
+		t.Error(err)
+	}
+
+	_, err = b.GetRaw(key, &raw).Run(con())
+	if err != nil || string(raw) != "hello" {
+		t.Error("unexpected result:", err, string(raw))
+	}
+
+	if requests != 4 {
+		t.Error("unexpected requests:", requests)
+	}
+
+	// Invalidated by Delete
+	_, err = b.Delete(key).Run(con())
+	if err != nil {
+		t.Error(err)
+	}
+
+	_, err = b.GetRaw(key, &raw).Run(con())
+	if err != ErrNotFound {
+		t.Error("unexpected error:", err)
+	}
+
+	if _, ok := store.Get(CacheKey{BucketType: "default", Bucket: "cache", Key: key}); ok {
+		t.Error("not found key was cached")
+	}
+}
+
+func TestLRUCache(t *testing.T) {
+	c := NewLRUCache(2, 0)
+
+	a := CacheKey{Bucket: "b", Key: "a"}
+	b := CacheKey{Bucket: "b", Key: "b"}
+
+	c.Set(a, CacheEntry{Value: []byte("a")})
+	c.Set(b, CacheEntry{Value: []byte("b")})
+
+	// a is now the most recently used
+	if e, ok := c.Get(a); !ok || string(e.Value) != "a" {
+		t.Error("unexpected entry:", e, ok)
+	}
+
+	c.Set(CacheKey{Bucket: "b", Key: "c"}, CacheEntry{})
+
+	if _, ok := c.Get(b); ok {
+		t.Error("least recently used entry was not removed")
+	}
+
+	if _, ok := c.Get(a); !ok {
+		t.Error("entry was removed")
+	}
+
+	c.Delete(a)
+
+	if _, ok := c.Get(a); ok {
+		t.Error("entry was not deleted")
+	}
+}
+
+func TestLRUCacheTTL(t *testing.T) {
+	c := NewLRUCache(10, 10*time.Millisecond)
+
+	key := CacheKey{Bucket: "b", Key: "a"}
+	c.Set(key, CacheEntry{})
+
+	if _, ok := c.Get(key); !ok {
+		t.Error("entry is missing")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	if _, ok := c.Get(key); ok {
+		t.Error("entry did not expire")
+	}
+}
+
+func TestLRUCacheSize(t *testing.T) {
+	for _, size := range []int{0, -1} {
+		c := NewLRUCache(size, 0)
+
+		for i := 0; i < 10; i++ {
+			c.Set(CacheKey{Bucket: "b", Key: strconv.Itoa(i)}, CacheEntry{})
+		}
+
+		// The default size is used
+		for i := 0; i < 10; i++ {
+			if _, ok := c.Get(CacheKey{Bucket: "b", Key: strconv.Itoa(i)}); !ok {
+				t.Error("entry is missing:", size, i)
+			}
+		}
+	}
+}
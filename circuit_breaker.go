@@ -0,0 +1,355 @@
+package goriak
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+
+	riak "github.com/basho/riak-go-client"
+)
+
+// CircuitBreakerPolicy configures CircuitBreakerMiddleware
+type CircuitBreakerPolicy struct {
+	// Circuit returns the name of the circuit that cmd belongs to. Every circuit trips independently.
+	// Defaults to the bucket type of the command.
+	Circuit func(cmd RunMiddlewarer) string
+
+	// FailureRatio is the ratio of failed commands in Window that trips the circuit. Defaults to 0.5.
+	FailureRatio float64
+
+	// MinRequests is the number of commands in Window that is needed before the circuit can trip. Defaults to 20.
+	MinRequests int
+
+	// Window is the duration that failures are counted over. The counts are reset after every Window. Defaults to 10s.
+	Window time.Duration
+
+	// OpenTimeout is the time that the circuit stays open, before commands are let through to probe if
+	// Riak has recovered. Defaults to 30s.
+	OpenTimeout time.Duration
+
+	// HalfOpenRequests is the number of probes that are let through when the circuit is half-open. The circuit is
+	// closed when all probes succeed, and opened again if a probe fails. Defaults to 1.
+	HalfOpenRequests int
+
+	// IsFailure decides if an error counts as a failure. Defaults to transient errors (IsTransient) and
+	// context.DeadlineExceeded.
+	IsFailure func(error) bool
+}
+
+// CircuitOpenError is returned by CircuitBreakerMiddleware when a command is rejected.
+// It matches ErrCircuitOpen when used with errors.Is.
+type CircuitOpenError struct {
+	// Circuit is the name of the circuit that is open, the bucket type by default.
+	// Circuit is the address of the node for CircuitBreakerNodeManager.
+	Circuit string
+}
+
+func (e *CircuitOpenError) Error() string {
+	return "goriak: circuit breaker is open for " + e.Circuit
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// CircuitBreakerMiddleware returns a middleware that rejects commands with a *CircuitOpenError without
+// executing them, when too many commands have failed.
+//
+// Commands are grouped in circuits, one per bucket type by default. A circuit is opened when at least MinRequests
+// commands have been executed during Window, and FailureRatio of them have failed. After OpenTimeout the circuit
+// is half-open, and HalfOpenRequests commands are executed to probe if Riak has recovered.
+//
+// Use CircuitBreakerNodeManager for a circuit per Riak node.
+func CircuitBreakerMiddleware(policy CircuitBreakerPolicy) RunMiddleware {
+	policy = circuitBreakerDefaults(policy)
+
+	var mu sync.Mutex
+	circuits := make(map[string]*circuit)
+
+	return func(cmd RunMiddlewarer, next func() (*Result, error)) (*Result, error) {
+		name := policy.Circuit(cmd)
+
+		mu.Lock()
+		c, ok := circuits[name]
+		if !ok {
+			c = &circuit{policy: &policy}
+			circuits[name] = c
+		}
+		mu.Unlock()
+
+		generation, ok := c.allow(time.Now())
+		if !ok {
+			return nil, &CircuitOpenError{Circuit: name}
+		}
+
+		res, err := next()
+
+		c.record(time.Now(), generation, policy.IsFailure(err))
+
+		return res, err
+	}
+}
+
+// circuitBreakerDefaults returns policy with the default values for all options that are not set
+func circuitBreakerDefaults(policy CircuitBreakerPolicy) CircuitBreakerPolicy {
+	if policy.Circuit == nil {
+		policy.Circuit = func(cmd RunMiddlewarer) string {
+			return cmd.BucketType()
+		}
+	}
+
+	if policy.FailureRatio <= 0 {
+		policy.FailureRatio = 0.5
+	}
+
+	if policy.MinRequests <= 0 {
+		policy.MinRequests = 20
+	}
+
+	if policy.Window <= 0 {
+		policy.Window = 10 * time.Second
+	}
+
+	if policy.OpenTimeout <= 0 {
+		policy.OpenTimeout = 30 * time.Second
+	}
+
+	if policy.HalfOpenRequests <= 0 {
+		policy.HalfOpenRequests = 1
+	}
+
+	if policy.IsFailure == nil {
+		policy.IsFailure = func(err error) bool {
+			return IsTransient(err) || errors.Is(err, context.DeadlineExceeded)
+		}
+	}
+
+	return policy
+}
+
+// CircuitBreakerNodeManager returns a riak.NodeManager with a circuit per Riak node, for use with
+// ConnectOpts.NodeManager. Nodes with an open circuit are skipped, and the command is executed by next on one
+// of the other nodes. next defaults to the round robin NodeManager of riak-go-client.
+//
+// The circuits use the same options as CircuitBreakerMiddleware, except Circuit which is not used. Commands fail
+// with a *CircuitOpenError if the circuits of all nodes are open. Streaming commands (AllKeys and KeysInIndex)
+// are executed on the nodes, but their results are not counted.
+func CircuitBreakerNodeManager(policy CircuitBreakerPolicy, next riak.NodeManager) riak.NodeManager {
+	if next == nil {
+		next = defaultNodeManager()
+	}
+
+	return &circuitNodeManager{
+		policy:      circuitBreakerDefaults(policy),
+		next:        next,
+		commandNode: commandNode,
+		circuits:    make(map[string]*circuit),
+	}
+}
+
+// defaultNodeManager returns the round robin NodeManager of riak-go-client.
+// It is not exported, and is read from the options of a new cluster.
+func defaultNodeManager() riak.NodeManager {
+	opts := &riak.ClusterOptions{NoDefaultNode: true}
+	_, _ = riak.NewCluster(opts)
+
+	return opts.NodeManager
+}
+
+// circuitNodeManager is a riak.NodeManager that skips nodes with an open circuit
+type circuitNodeManager struct {
+	policy CircuitBreakerPolicy
+	next   riak.NodeManager
+
+	// commandNode returns the address of the node that executed a command
+	commandNode func(riak.Command) string
+
+	mu       sync.Mutex
+	circuits map[string]*circuit // By node address
+}
+
+// allowedNode is a node that a command can be executed on
+type allowedNode struct {
+	address    string
+	circuit    *circuit
+	generation uint64
+}
+
+func (m *circuitNodeManager) ExecuteOnNode(nodes []*riak.Node, command riak.Command, previous *riak.Node) (bool, error) {
+	now := time.Now()
+
+	available := make([]*riak.Node, 0, len(nodes))
+	allowed := make([]allowedNode, 0, len(nodes))
+
+	var openErr error
+
+	for _, node := range nodes {
+		address := nodeAddress(reflect.ValueOf(node))
+		c := m.circuit(address)
+
+		generation, ok := c.allow(now)
+		if !ok {
+			if openErr == nil {
+				openErr = &CircuitOpenError{Circuit: address}
+			}
+
+			continue
+		}
+
+		available = append(available, node)
+		allowed = append(allowed, allowedNode{address: address, circuit: c, generation: generation})
+	}
+
+	if len(available) == 0 && openErr != nil {
+		return false, openErr
+	}
+
+	executed, err := m.next.ExecuteOnNode(available, command, previous)
+
+	// The node is only known if it executed the command
+	var node string
+	if executed {
+		node = m.commandNode(command)
+	}
+
+	for _, a := range allowed {
+		if a.address == node {
+			a.circuit.record(time.Now(), a.generation, m.policy.IsFailure(newRiakError(err, node)))
+		} else {
+			// Give back the half-open probes of the nodes that were not used
+			a.circuit.release(a.generation)
+		}
+	}
+
+	return executed, err
+}
+
+// circuit returns the circuit of the node with address
+func (m *circuitNodeManager) circuit(address string) *circuit {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.circuits[address]
+	if !ok {
+		c = &circuit{policy: &m.policy}
+		m.circuits[address] = c
+	}
+
+	return c
+}
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// circuit is the state of a single circuit
+type circuit struct {
+	policy *CircuitBreakerPolicy
+
+	mu    sync.Mutex
+	state circuitState
+
+	// generation is increased on every state change, so that commands that were started
+	// in a previous state are not counted
+	generation uint64
+
+	windowStart time.Time
+	requests    int
+	failures    int
+
+	openedAt time.Time
+	probes   int // Probes started in the half-open state
+}
+
+// allow returns true if a command can be executed, and the generation that the result should be recorded in
+func (c *circuit) allow(now time.Time) (uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch c.state {
+	case circuitOpen:
+		if now.Sub(c.openedAt) < c.policy.OpenTimeout {
+			return 0, false
+		}
+
+		c.setState(circuitHalfOpen, now)
+		fallthrough
+
+	case circuitHalfOpen:
+		if c.probes >= c.policy.HalfOpenRequests {
+			return 0, false
+		}
+
+		c.probes++
+
+	default:
+		if now.Sub(c.windowStart) >= c.policy.Window {
+			c.windowStart = now
+			c.requests = 0
+			c.failures = 0
+		}
+	}
+
+	return c.generation, true
+}
+
+// record saves the result of a command
+func (c *circuit) record(now time.Time, generation uint64, failure bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	switch c.state {
+	case circuitClosed:
+		c.requests++
+		if failure {
+			c.failures++
+		}
+
+		if c.requests >= c.policy.MinRequests && float64(c.failures)/float64(c.requests) >= c.policy.FailureRatio {
+			c.setState(circuitOpen, now)
+		}
+
+	case circuitHalfOpen:
+		if failure {
+			c.setState(circuitOpen, now)
+			return
+		}
+
+		// Successful probes are counted in requests
+		c.requests++
+		if c.requests >= c.policy.HalfOpenRequests {
+			c.setState(circuitClosed, now)
+		}
+	}
+}
+
+// release gives back a probe from allow, for a command that was not executed
+func (c *circuit) release(generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation == c.generation && c.state == circuitHalfOpen && c.probes > 0 {
+		c.probes--
+	}
+}
+
+func (c *circuit) setState(state circuitState, now time.Time) {
+	c.state = state
+	c.generation++
+
+	c.windowStart = now
+	c.requests = 0
+	c.failures = 0
+	c.probes = 0
+	c.openedAt = now
+}
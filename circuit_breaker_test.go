@@ -0,0 +1,267 @@
+package goriak
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	riak "github.com/basho/riak-go-client"
+)
+
+func TestCircuitBreakerMiddleware(t *testing.T) {
+	fail := true
+	requests := 0
+
+	backend := func(cmd RunMiddlewarer, next func() (*Result, error)) (*Result, error) {
+		requests++
+
+		if fail {
+			return nil, riakTestError("overload")
+		}
+
+		return next()
+	}
+
+	breaker := CircuitBreakerMiddleware(CircuitBreakerPolicy{
+		FailureRatio: 0.5,
+		MinRequests:  4,
+		Window:       time.Minute,
+		OpenTimeout:  20 * time.Millisecond,
+	})
+
+	run := func(bucketType string) error {
+		_, err := Bucket("breaker", bucketType).
+			RegisterRunMiddleware(breaker).
+			RegisterRunMiddleware(backend).
+			Delete("key").
+			Run(con())
+		return err
+	}
+
+	for i := 0; i < 4; i++ {
+		if err := run("default"); errors.Is(err, ErrCircuitOpen) {
+			t.Error("circuit opened too early")
+		}
+	}
+
+	err := run("default")
+
+	var circuitErr *CircuitOpenError
+	if !errors.As(err, &circuitErr) || circuitErr.Circuit != "default" || !errors.Is(err, ErrCircuitOpen) {
+		t.Error("unexpected error:", err)
+	}
+
+	if requests != 4 {
+		t.Error("unexpected requests:", requests)
+	}
+
+	// Other bucket types are not affected
+	fail = false
+
+	if err := run("tests"); err != nil {
+		t.Error(err)
+	}
+
+	// Half-open, the probe fails and the circuit opens again
+	fail = true
+	time.Sleep(30 * time.Millisecond)
+	requests = 0
+
+	if err := run("default"); errors.Is(err, ErrCircuitOpen) {
+		t.Error("probe was not executed")
+	}
+
+	if err := run("default"); !errors.Is(err, ErrCircuitOpen) {
+		t.Error("unexpected error:", err)
+	}
+
+	if requests != 1 {
+		t.Error("unexpected requests:", requests)
+	}
+
+	// Half-open, the probe succeeds and the circuit closes
+	fail = false
+	time.Sleep(30 * time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		if err := run("default"); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestCircuitBreakerIgnoredErrors(t *testing.T) {
+	breaker := CircuitBreakerMiddleware(CircuitBreakerPolicy{
+		MinRequests: 2,
+	})
+
+	var raw []byte
+
+	for i := 0; i < 5; i++ {
+		// Not found, and cancelled commands are not failures
+		_, err := Bucket("breaker", "default").RegisterRunMiddleware(breaker).GetRaw(randomKey(), &raw).Run(con())
+		if err != ErrNotFound {
+			t.Error("unexpected error:", err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err = Bucket("breaker", "default").RegisterRunMiddleware(breaker).GetRaw(randomKey(), &raw).RunContext(ctx, con())
+		if err != context.Canceled {
+			t.Error("unexpected error:", err)
+		}
+	}
+}
+
+func TestCircuitHalfOpenProbes(t *testing.T) {
+	policy := &CircuitBreakerPolicy{
+		FailureRatio:     1,
+		MinRequests:      1,
+		Window:           time.Minute,
+		OpenTimeout:      time.Second,
+		HalfOpenRequests: 2,
+	}
+
+	c := &circuit{policy: policy}
+	now := time.Now()
+
+	gen, _ := c.allow(now)
+	c.record(now, gen, true)
+
+	if _, ok := c.allow(now); ok {
+		t.Error("circuit is not open")
+	}
+
+	now = now.Add(time.Second)
+
+	gen1, ok1 := c.allow(now)
+	gen2, ok2 := c.allow(now)
+	_, ok3 := c.allow(now)
+
+	if !ok1 || !ok2 || ok3 {
+		t.Error("unexpected probes:", ok1, ok2, ok3)
+	}
+
+	c.record(now, gen1, false)
+
+	if c.state != circuitHalfOpen {
+		t.Error("circuit closed after one probe")
+	}
+
+	c.record(now, gen2, false)
+
+	if c.state != circuitClosed {
+		t.Error("circuit is not closed")
+	}
+
+	// Results from an old generation are ignored
+	c.record(now, gen1, true)
+
+	if c.requests != 0 {
+		t.Error("old result was recorded")
+	}
+}
+
+// testNodeManager executes commands on the first node, and fails on the nodes in failing
+type testNodeManager struct {
+	failing  map[string]bool
+	executed []string
+}
+
+func (m *testNodeManager) ExecuteOnNode(nodes []*riak.Node, command riak.Command, previous *riak.Node) (bool, error) {
+	address := nodeAddress(reflect.ValueOf(nodes[0]))
+	m.executed = append(m.executed, address)
+
+	if m.failing[address] {
+		return true, riakTestError("overload")
+	}
+
+	return true, nil
+}
+
+func TestCircuitBreakerNodeManager(t *testing.T) {
+	if CircuitBreakerNodeManager(CircuitBreakerPolicy{}, nil).(*circuitNodeManager).next == nil {
+		t.Error("no default NodeManager")
+	}
+
+	var nodes []*riak.Node
+
+	for _, address := range []string{"127.0.0.1:10017", "127.0.0.1:10027"} {
+		node, err := riak.NewNode(&riak.NodeOptions{RemoteAddress: address})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		nodes = append(nodes, node)
+	}
+
+	next := &testNodeManager{failing: map[string]bool{"127.0.0.1:10017": true}}
+
+	manager := CircuitBreakerNodeManager(CircuitBreakerPolicy{
+		FailureRatio: 0.5,
+		MinRequests:  2,
+		Window:       time.Minute,
+		OpenTimeout:  20 * time.Millisecond,
+	}, next).(*circuitNodeManager)
+
+	// The test manager does not set the node on the command
+	manager.commandNode = func(riak.Command) string {
+		return next.executed[len(next.executed)-1]
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := manager.ExecuteOnNode(nodes, nil, nil); err == nil {
+			t.Error("expected error")
+		}
+	}
+
+	// The first node is skipped
+	for i := 0; i < 3; i++ {
+		if _, err := manager.ExecuteOnNode(nodes, nil, nil); err != nil {
+			t.Error(err)
+		}
+	}
+
+	expected := []string{"127.0.0.1:10017", "127.0.0.1:10017", "127.0.0.1:10027", "127.0.0.1:10027", "127.0.0.1:10027"}
+	if !reflect.DeepEqual(next.executed, expected) {
+		t.Error("unexpected nodes:", next.executed)
+	}
+
+	// All nodes are open
+	next.failing["127.0.0.1:10027"] = true
+
+	for i := 0; i < 3; i++ {
+		manager.ExecuteOnNode(nodes, nil, nil)
+	}
+
+	executed, err := manager.ExecuteOnNode(nodes, nil, nil)
+
+	var circuitErr *CircuitOpenError
+	if executed || !errors.As(err, &circuitErr) || circuitErr.Circuit != "127.0.0.1:10017" {
+		t.Error("unexpected result:", executed, err)
+	}
+
+	// The error from riak-go-client is returned as the *CircuitOpenError
+	if err := newRiakError(riak.ClientError{Errmsg: riak.ErrClusterNoNodesAvailable, InnerError: err}, ""); err != circuitErr {
+		t.Error("unexpected error:", err)
+	}
+
+	// Half-open, the probe succeeds and the first node is used again
+	delete(next.failing, "127.0.0.1:10017")
+	time.Sleep(30 * time.Millisecond)
+	next.executed = nil
+
+	for i := 0; i < 2; i++ {
+		if _, err := manager.ExecuteOnNode(nodes, nil, nil); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if !reflect.DeepEqual(next.executed, []string{"127.0.0.1:10017", "127.0.0.1:10017"}) {
+		t.Error("unexpected nodes:", next.executed)
+	}
+}
@@ -3,18 +3,31 @@ package goriak
 import (
 	riak "github.com/basho/riak-go-client"
 
+	"context"
 	"crypto/tls"
-	"crypto/x509"
-	"errors"
-	"io/ioutil"
+	"fmt"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 // Session holds the connection to Riak
 type Session struct {
-	riak *riak.Cluster
-	opts ConnectOpts
+	backend backend
+	opts    ConnectOpts
+
+	// Tracks in-flight commands, used by Shutdown to drain the session
+	mu       sync.RWMutex
+	closed   bool
+	inflight sync.WaitGroup
+
+	// Stops the NodeResolver loop, if NodeResolver is set
+	stopResolver chan struct{}
+	resolverDone chan struct{}
+
+	// Middleware added with Use, protected by mu
+	middleware []RunMiddleware
 }
 
 // ConnectOpts are the available options for connecting to your Riak instance
@@ -23,15 +36,70 @@ type ConnectOpts struct {
 	Address   string   // Address to a single Riak host. Will be used in case Addresses is empty
 	Addresses []string // Addresses to all Riak hosts.
 
-	// Username and password for connection to servers with secirity enabled
+	// Username and password for connection to servers with secirity enabled.
+	// TLS is used when User is set.
 	User     string
 	Password string
 
-	// Path to root CA certificate. Required if security is used
+	// Path to root CA certificate. The system root CAs are used if not set.
 	CARootCert string
 
+	// Paths to a PEM encoded client certificate and private key.
+	// Used for authentication with the Riak security source "certificate".
+	ClientCert string
+	ClientKey  string
+
+	// TLSConfig is used instead of the default TLS configuration when security is used.
+	// CARootCert, ClientCert and ClientKey are added to a clone of TLSConfig if set.
+	// If ServerName is empty, it is set to the host of each node.
+	TLSConfig *tls.Config
+
+	// Disables verification of the server certificate. Should only be used for testing.
+	InsecureSkipVerify bool
+
 	// Option to override port. Is set to 8087 by default
 	Port uint32
+
+	// Connection pool options for all nodes.
+	// The default values from riak-go-client are used for all options that are not set.
+	MinConnections      uint16        // Minimum number of open connections per node
+	MaxConnections      uint16        // Maximum number of open connections per node
+	IdleTimeout         time.Duration // Connections above MinConnections are closed after being idle for this long
+	ConnectTimeout      time.Duration // Timeout when opening a new connection
+	RequestTimeout      time.Duration // Timeout of a single request to Riak
+	HealthCheckInterval time.Duration // Interval between health checks of nodes that are unavailable
+
+	// Per address overrides of the connection pool options.
+	// The key is the address as it is written in Address or Addresses.
+	NodeOptions map[string]NodeOpts
+
+	// Number of times a command is attempted before it fails. Is set to 3 by default.
+	ExecutionAttempts byte
+
+	// NodeManager selects the node that executes a command. Uses round robin by default.
+	// Commands that are sent to a specific node, such as by NodesServerInfo, are passed only that node.
+	NodeManager riak.NodeManager
+
+	// NodeResolver is an optional function that returns the addresses of all nodes in the cluster,
+	// such as from a DNS SRV lookup. It is called every NodeResolverInterval (30 seconds by default),
+	// and nodes are added to and removed from the Session to match the returned addresses.
+	NodeResolver         func(ctx context.Context) ([]string, error)
+	NodeResolverInterval time.Duration
+
+	// If CheckServerVersion is set, Connect verifies that all nodes are reachable and are
+	// running Riak 2.0 or later. ErrUnsupportedServerVersion is returned for older versions.
+	CheckServerVersion bool
+}
+
+// NodeOpts holds connection pool options for a single node, see ConnectOpts for a description of the options.
+// Options that are not set uses the value from ConnectOpts.
+type NodeOpts struct {
+	MinConnections      uint16
+	MaxConnections      uint16
+	IdleTimeout         time.Duration
+	ConnectTimeout      time.Duration
+	RequestTimeout      time.Duration
+	HealthCheckInterval time.Duration
 }
 
 // Connect creates a new Riak connection. See ConnectOpts for the available options.
@@ -54,76 +122,213 @@ func (c *Session) connect() error {
 		c.opts.Addresses = []string{c.opts.Address}
 	}
 
-	var authOptions *riak.AuthOptions
+	authOptions, err := c.opts.authOptions()
+	if err != nil {
+		return err
+	}
+
+	backend := &riakBackend{
+		nodeManager: newPinnedNodeManager(c.opts.NodeManager),
+		opts:        c.opts,
+		auth:        authOptions,
+	}
+
+	var nodes []*riak.Node
 
-	// Build auth options
-	if c.opts.User != "" {
-		rootCertPemData, err := ioutil.ReadFile(c.opts.CARootCert)
+	for _, configAddress := range c.opts.Addresses {
+		node, err := backend.newNode(configAddress)
 		if err != nil {
-			return errors.New("Opening CARootCert: " + err.Error())
+			return err
 		}
 
-		rootCertPool := x509.NewCertPool()
-		if !rootCertPool.AppendCertsFromPEM(rootCertPemData) {
-			return errors.New("Invalid PEM certificate file")
-		}
+		nodes = append(nodes, node.node)
+		backend.nodes = append(backend.nodes, node)
+	}
 
-		tlsConf := &tls.Config{
-			InsecureSkipVerify: true,
-			RootCAs:            rootCertPool,
-		}
+	con, err := riak.NewCluster(&riak.ClusterOptions{
+		Nodes:             nodes,
+		ExecutionAttempts: c.opts.ExecutionAttempts,
+		NodeManager:       backend.nodeManager,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = con.Start()
+	if err != nil {
+		return err
+	}
+
+	backend.cluster = con
+	c.backend = backend
 
-		authOptions = &riak.AuthOptions{
-			User:      c.opts.User,
-			Password:  c.opts.Password,
-			TlsConfig: tlsConf,
+	if c.opts.CheckServerVersion {
+		err = c.checkServerVersion(context.Background())
+		if err != nil {
+			con.Stop()
+			return err
 		}
 	}
 
-	var nodes []*riak.Node
+	if c.opts.NodeResolver != nil {
+		c.startNodeResolver()
+	}
+
+	return nil
+}
+
+// address returns configAddress with the default port added, if configAddress does not have a port
+func (o ConnectOpts) address(configAddress string) string {
+	if strings.Contains(configAddress, ":") {
+		return configAddress
+	}
 
 	// Set to default port if not provided
-	port := c.opts.Port
+	port := o.Port
 	if port == 0 {
 		port = 8087
 	}
 
-	for _, address := range c.opts.Addresses {
-		if !strings.Contains(address, ":") {
-			// Add port if not set in the user config
-			address = address + ":" + strconv.FormatUint(uint64(port), 10)
-		}
+	return configAddress + ":" + strconv.FormatUint(uint64(port), 10)
+}
 
-		// Set ServerName based on the address we're connecting to
-		if authOptions != nil {
-			addressWithoutPort := address[0:strings.Index(address, ":")]
-			authOptions.TlsConfig.ServerName = addressWithoutPort
-		}
+// nodeOptions returns the options for the node at address.
+// configAddress is the address as it was written in ConnectOpts, and is used to find per address overrides.
+func (o ConnectOpts) nodeOptions(configAddress, address string) (*riak.NodeOptions, error) {
+	opts := NodeOpts{
+		MinConnections:      o.MinConnections,
+		MaxConnections:      o.MaxConnections,
+		IdleTimeout:         o.IdleTimeout,
+		ConnectTimeout:      o.ConnectTimeout,
+		RequestTimeout:      o.RequestTimeout,
+		HealthCheckInterval: o.HealthCheckInterval,
+	}
 
-		node, err := riak.NewNode(&riak.NodeOptions{
-			RemoteAddress: address,
-			AuthOptions:   authOptions,
-		})
-		if err != nil {
-			return err
-		}
+	override, ok := o.NodeOptions[configAddress]
+	if !ok {
+		override = o.NodeOptions[address]
+	}
 
-		nodes = append(nodes, node)
+	if override.MinConnections > 0 {
+		opts.MinConnections = override.MinConnections
 	}
 
-	con, err := riak.NewCluster(&riak.ClusterOptions{
-		Nodes: nodes,
-	})
-	if err != nil {
+	if override.MaxConnections > 0 {
+		opts.MaxConnections = override.MaxConnections
+	}
+
+	if override.IdleTimeout > 0 {
+		opts.IdleTimeout = override.IdleTimeout
+	}
+
+	if override.ConnectTimeout > 0 {
+		opts.ConnectTimeout = override.ConnectTimeout
+	}
+
+	if override.RequestTimeout > 0 {
+		opts.RequestTimeout = override.RequestTimeout
+	}
+
+	if override.HealthCheckInterval > 0 {
+		opts.HealthCheckInterval = override.HealthCheckInterval
+	}
+
+	if opts.MaxConnections > 0 && opts.MinConnections > opts.MaxConnections {
+		return nil, fmt.Errorf("goriak: MinConnections (%d) is greater than MaxConnections (%d) for %s", opts.MinConnections, opts.MaxConnections, address)
+	}
+
+	return &riak.NodeOptions{
+		RemoteAddress:       address,
+		MinConnections:      opts.MinConnections,
+		MaxConnections:      opts.MaxConnections,
+		IdleTimeout:         opts.IdleTimeout,
+		ConnectTimeout:      opts.ConnectTimeout,
+		RequestTimeout:      opts.RequestTimeout,
+		HealthCheckInterval: opts.HealthCheckInterval,
+	}, nil
+}
+
+// execute performs req on the backend of the session.
+// ErrSessionClosed is returned if the session has been closed.
+func (c *Session) execute(ctx context.Context, req request) error {
+	if err := c.begin(); err != nil {
 		return err
 	}
 
-	err = con.Start()
-	if err != nil {
+	defer c.inflight.Done()
+
+	return c.backend.execute(ctx, req)
+}
+
+// executeOnNode performs req on the node with address
+func (c *Session) executeOnNode(ctx context.Context, address string, req request) error {
+	if err := c.begin(); err != nil {
 		return err
 	}
 
-	c.riak = con
+	defer c.inflight.Done()
+
+	return c.backend.executeOnNode(ctx, address, req)
+}
+
+// begin marks the start of a new in-flight command, c.inflight.Done() must be called when the command has finished.
+// ErrSessionClosed is returned if the session has been closed.
+func (c *Session) begin() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.closed {
+		return ErrSessionClosed
+	}
+
+	c.inflight.Add(1)
 
 	return nil
 }
+
+// Close stops the session. It is the same as Shutdown with a background context,
+// and waits for all in-flight commands to finish before the connections are closed.
+func (c *Session) Close() error {
+	return c.Shutdown(context.Background())
+}
+
+// Shutdown gracefully stops the session. New commands are rejected with ErrSessionClosed,
+// and Shutdown waits for all in-flight commands to finish before the connections to Riak are closed.
+//
+// If ctx is done before all commands have finished, the connections are closed anyway and the
+// context error is returned. Calling Shutdown on a session that already is closed returns ErrSessionClosed.
+func (c *Session) Shutdown(ctx context.Context) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrSessionClosed
+	}
+	c.closed = true
+	c.mu.Unlock()
+
+	if c.stopResolver != nil {
+		close(c.stopResolver)
+		<-c.resolverDone
+	}
+
+	drained := make(chan struct{})
+
+	go func() {
+		c.inflight.Wait()
+		close(drained)
+	}()
+
+	var ctxErr error
+
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		ctxErr = ctx.Err()
+	}
+
+	if err := c.backend.close(); err != nil {
+		return err
+	}
+
+	return ctxErr
+}
@@ -0,0 +1,85 @@
+package goriak
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConnectPoolOptions(t *testing.T) {
+	c, err := Connect(ConnectOpts{
+		Addresses:         []string{"127.0.0.1"},
+		MinConnections:    2,
+		MaxConnections:    16,
+		IdleTimeout:       time.Minute,
+		ConnectTimeout:    time.Second,
+		RequestTimeout:    5 * time.Second,
+		ExecutionAttempts: 2,
+		NodeOptions: map[string]NodeOpts{
+			"127.0.0.1": {MaxConnections: 32},
+		},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	defer c.Close()
+
+	_, err = Bucket("testsuite", "tests").SetRaw([]byte{1, 2, 3}).Run(c)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConnectOptsNodeOptions(t *testing.T) {
+	opts := ConnectOpts{
+		MinConnections: 2,
+		MaxConnections: 16,
+		RequestTimeout: time.Second,
+		NodeOptions: map[string]NodeOpts{
+			"a":      {MaxConnections: 32},
+			"b:8087": {MinConnections: 4, RequestTimeout: time.Minute},
+		},
+	}
+
+	a, err := opts.nodeOptions("a", "a:8087")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if a.RemoteAddress != "a:8087" || a.MinConnections != 2 || a.MaxConnections != 32 || a.RequestTimeout != time.Second {
+		t.Errorf("unexpected options: %+v", a)
+	}
+
+	b, err := opts.nodeOptions("b", "b:8087")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if b.MinConnections != 4 || b.MaxConnections != 16 || b.RequestTimeout != time.Minute {
+		t.Errorf("unexpected options: %+v", b)
+	}
+
+	c, err := opts.nodeOptions("c", "c:8087")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if c.MinConnections != 2 || c.MaxConnections != 16 || c.RequestTimeout != time.Second {
+		t.Errorf("unexpected options: %+v", c)
+	}
+}
+
+func TestConnectMinGreaterThanMax(t *testing.T) {
+	_, err := Connect(ConnectOpts{
+		Addresses: []string{"127.0.0.1"},
+		NodeOptions: map[string]NodeOpts{
+			"127.0.0.1": {MinConnections: 10, MaxConnections: 5},
+		},
+	})
+
+	if err == nil || !strings.Contains(err.Error(), "MinConnections") {
+		t.Error("unexpected error:", err)
+	}
+}
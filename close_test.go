@@ -0,0 +1,106 @@
+package goriak
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSessionClose(t *testing.T) {
+	c, err := Connect(ConnectOpts{
+		Addresses: []string{"127.0.0.1"},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = c.Close()
+	if err != nil {
+		t.Error(err)
+	}
+
+	var out []byte
+	_, err = Bucket("testsuite", "tests").GetRaw("key", &out).Run(c)
+	if !errors.Is(err, ErrSessionClosed) {
+		t.Error("unexpected error:", err)
+	}
+
+	err = c.Close()
+	if !errors.Is(err, ErrSessionClosed) {
+		t.Error("unexpected error:", err)
+	}
+}
+
+func TestSessionShutdownDrain(t *testing.T) {
+	c := NewMemorySession()
+
+	_, err := Bucket("drain", "default").SetRaw([]byte{1}).Key("a").Run(c)
+	if err != nil {
+		t.Error(err)
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error)
+
+	go func() {
+		_, err := Bucket("drain", "default").AllKeys(func([]string) error {
+			close(started)
+			<-release
+			return nil
+		}).Run(c)
+		done <- err
+	}()
+
+	<-started
+
+	shutdown := make(chan error)
+
+	go func() {
+		shutdown <- c.Shutdown(context.Background())
+	}()
+
+	select {
+	case <-shutdown:
+		t.Error("Shutdown returned before the command had finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+
+	if err := <-done; err != nil {
+		t.Error("in-flight command failed:", err)
+	}
+
+	if err := <-shutdown; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSessionShutdownTimeout(t *testing.T) {
+	c := NewMemorySession()
+
+	Bucket("drain", "default").SetRaw([]byte{1}).Key("a").Run(c)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+
+	go Bucket("drain", "default").AllKeys(func([]string) error {
+		close(started)
+		<-release
+		return nil
+	}).Run(c)
+
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := c.Shutdown(ctx)
+	if err != context.DeadlineExceeded {
+		t.Error("unexpected error:", err)
+	}
+}
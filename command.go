@@ -15,6 +15,9 @@ type Result struct {
 	NotFound bool   // Wether or not the item was not found when using Get, GetJSON, or GetRaw.
 	Key      string // Returns your automatically generated key when using Set, SetJSON, or SetRaw.
 	Context  []byte // Returns the Riak Context used in map operations. Is set when using Get.
+	Siblings int    // The number of siblings that were resolved by a conflict resolver in GetJSON or GetRaw. Is 0 when there was no conflict.
+	Value    []byte // The fetched value when using GetJSON or GetRaw.
+	VClock   []byte // The vector clock of the fetched value when using GetJSON or GetRaw.
 }
 
 // Bucket specifies the bucket and bucket type that your following command will be performed on.
@@ -26,7 +29,8 @@ func Bucket(bucket, bucketType string) *Command {
 }
 
 // RegisterRunMiddleware adds a middleware function that will wrap the execution of the command.
-// Is currently supported by Get, GetRaw, GetJSON, Set, SetRaw, and SetJSON
+// The middleware is used by all commands created from c, and by Exec() on the Counter, Set, Flag and Register
+// helpers that were retrieved or saved with Get or Set.
 func (c *Command) RegisterRunMiddleware(middleware RunMiddleware) *Command {
 	c.runMiddleware = append(c.runMiddleware, middleware)
 	return c
@@ -0,0 +1,304 @@
+package goriak
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// connectParams are the parameters that can be used in a connection URL, and as environment variables.
+// The environment variable is the upper case parameter name prefixed with GORIAK_, such as GORIAK_POOL_MAX.
+var connectParams = []string{
+	"addresses",
+	"user",
+	"password",
+	"port",
+	"ca",
+	"client_cert",
+	"client_key",
+	"insecure_skip_verify",
+	"pool_min",
+	"pool_max",
+	"idle_timeout",
+	"connect_timeout",
+	"request_timeout",
+	"health_check_interval",
+	"execution_attempts",
+	"check_server_version",
+	"node_resolver_interval",
+}
+
+// ConnectURL creates a new Riak connection from a connection URL. See ParseURL for the URL format.
+func ConnectURL(rawURL string) (*Session, error) {
+	opts, err := ParseURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return Connect(opts)
+}
+
+// ParseURL parses a connection URL to ConnectOpts. The URL has the format:
+//
+//	riak://[user[:password]@]host1[:port][,host2[:port],...][/][?param=value&...]
+//
+// The available parameters are:
+//
+//	port                   Default port (ConnectOpts.Port)
+//	ca                     Path to the root CA certificate (ConnectOpts.CARootCert)
+//	client_cert            Path to the client certificate (ConnectOpts.ClientCert)
+//	client_key             Path to the client key (ConnectOpts.ClientKey)
+//	insecure_skip_verify   ConnectOpts.InsecureSkipVerify
+//	pool_min               ConnectOpts.MinConnections
+//	pool_max               ConnectOpts.MaxConnections
+//	idle_timeout           ConnectOpts.IdleTimeout, such as "30s"
+//	connect_timeout        ConnectOpts.ConnectTimeout
+//	request_timeout        ConnectOpts.RequestTimeout
+//	health_check_interval  ConnectOpts.HealthCheckInterval
+//	execution_attempts     ConnectOpts.ExecutionAttempts
+//	check_server_version   ConnectOpts.CheckServerVersion
+//	node_resolver_interval ConnectOpts.NodeResolverInterval
+//
+// The pool parameters (pool_min to health_check_interval) can be set for a single address by prefixing the
+// parameter with the address, such as "host2.pool_max=128". They are saved to ConnectOpts.NodeOptions.
+func ParseURL(rawURL string) (ConnectOpts, error) {
+	var opts ConnectOpts
+
+	const scheme = "riak://"
+
+	if !strings.HasPrefix(rawURL, scheme) {
+		return opts, errors.New("goriak: invalid scheme in URL, expected riak://")
+	}
+
+	rest := rawURL[len(scheme):]
+
+	var query string
+	if i := strings.Index(rest, "?"); i >= 0 {
+		rest, query = rest[:i], rest[i+1:]
+	}
+
+	if i := strings.Index(rest, "/"); i >= 0 {
+		if strings.Trim(rest[i:], "/") != "" {
+			return opts, errors.New("goriak: unexpected path in URL: " + rest[i:])
+		}
+
+		rest = rest[:i]
+	}
+
+	if i := strings.LastIndex(rest, "@"); i >= 0 {
+		userinfo := rest[:i]
+		rest = rest[i+1:]
+
+		user, password := userinfo, ""
+		if j := strings.Index(userinfo, ":"); j >= 0 {
+			user, password = userinfo[:j], userinfo[j+1:]
+		}
+
+		var err error
+
+		if opts.User, err = url.PathUnescape(user); err != nil {
+			return opts, fmt.Errorf("goriak: invalid user in URL: %v", err)
+		}
+
+		if opts.Password, err = url.PathUnescape(password); err != nil {
+			return opts, fmt.Errorf("goriak: invalid password in URL: %v", err)
+		}
+	}
+
+	if rest != "" {
+		if err := opts.setParam("addresses", rest); err != nil {
+			return opts, fmt.Errorf("goriak: invalid hosts in URL: %v", err)
+		}
+	}
+
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return opts, fmt.Errorf("goriak: invalid query in URL: %v", err)
+	}
+
+	for name, value := range values {
+		v := value[len(value)-1]
+
+		// Per address parameter
+		if i := strings.LastIndex(name, "."); i >= 0 {
+			if err := opts.setNodeParam(name[:i], name[i+1:], v); err != nil {
+				return opts, fmt.Errorf("goriak: invalid URL parameter %s: %v", name, err)
+			}
+
+			continue
+		}
+
+		if err := opts.setParam(name, v); err != nil {
+			return opts, fmt.Errorf("goriak: invalid URL parameter %s: %v", name, err)
+		}
+	}
+
+	if len(opts.Addresses) == 0 {
+		return opts, errors.New("goriak: no hosts in URL")
+	}
+
+	return opts, nil
+}
+
+// ConnectOptsFromEnv creates ConnectOpts from environment variables.
+//
+// If GORIAK_URL is set, it is parsed with ParseURL. All parameters supported by ParseURL can also be set
+// with an environment variable, which overrides the value from the URL. The name of the variable is the
+// upper case parameter name prefixed with GORIAK_, such as GORIAK_POOL_MAX or GORIAK_REQUEST_TIMEOUT.
+// The addresses and credentials are set with GORIAK_ADDRESSES (comma separated), GORIAK_USER and GORIAK_PASSWORD.
+func ConnectOptsFromEnv() (ConnectOpts, error) {
+	var opts ConnectOpts
+
+	if rawURL := os.Getenv("GORIAK_URL"); rawURL != "" {
+		var err error
+
+		opts, err = ParseURL(rawURL)
+		if err != nil {
+			return opts, fmt.Errorf("goriak: invalid GORIAK_URL: %v", err)
+		}
+	}
+
+	for _, name := range connectParams {
+		env := "GORIAK_" + strings.ToUpper(name)
+
+		value, ok := os.LookupEnv(env)
+		if !ok {
+			continue
+		}
+
+		if err := opts.setParam(name, value); err != nil {
+			return opts, fmt.Errorf("goriak: invalid %s: %v", env, err)
+		}
+	}
+
+	if len(opts.Addresses) == 0 {
+		return opts, errors.New("goriak: GORIAK_URL or GORIAK_ADDRESSES must be set")
+	}
+
+	return opts, nil
+}
+
+// setParam sets the ConnectOpts field for the parameter name
+func (o *ConnectOpts) setParam(name, value string) error {
+	var err error
+
+	switch name {
+	case "addresses":
+		o.Addresses = nil
+
+		for _, address := range strings.Split(value, ",") {
+			address = strings.TrimSpace(address)
+			if address == "" {
+				return errors.New("empty address")
+			}
+
+			o.Addresses = append(o.Addresses, address)
+		}
+
+	case "user":
+		o.User = value
+
+	case "password":
+		o.Password = value
+
+	case "port":
+		var port uint64
+		port, err = strconv.ParseUint(value, 10, 16)
+		o.Port = uint32(port)
+
+	case "ca":
+		o.CARootCert = value
+
+	case "client_cert":
+		o.ClientCert = value
+
+	case "client_key":
+		o.ClientKey = value
+
+	case "insecure_skip_verify":
+		o.InsecureSkipVerify, err = strconv.ParseBool(value)
+
+	case "execution_attempts":
+		var attempts uint64
+		attempts, err = strconv.ParseUint(value, 10, 8)
+		o.ExecutionAttempts = byte(attempts)
+
+	case "check_server_version":
+		o.CheckServerVersion, err = strconv.ParseBool(value)
+
+	case "node_resolver_interval":
+		o.NodeResolverInterval, err = time.ParseDuration(value)
+
+	case "pool_min":
+		o.MinConnections, err = parseUint16(value)
+
+	case "pool_max":
+		o.MaxConnections, err = parseUint16(value)
+
+	case "idle_timeout":
+		o.IdleTimeout, err = time.ParseDuration(value)
+
+	case "connect_timeout":
+		o.ConnectTimeout, err = time.ParseDuration(value)
+
+	case "request_timeout":
+		o.RequestTimeout, err = time.ParseDuration(value)
+
+	case "health_check_interval":
+		o.HealthCheckInterval, err = time.ParseDuration(value)
+
+	default:
+		err = errors.New("unknown parameter")
+	}
+
+	return err
+}
+
+// setNodeParam sets a pool parameter in NodeOptions for address
+func (o *ConnectOpts) setNodeParam(address, name, value string) error {
+	node, err := o.NodeOptions[address].withParam(name, value)
+	if err != nil {
+		return err
+	}
+
+	if o.NodeOptions == nil {
+		o.NodeOptions = make(map[string]NodeOpts)
+	}
+
+	o.NodeOptions[address] = node
+
+	return nil
+}
+
+// withParam returns a copy of o with the pool parameter name set
+func (o NodeOpts) withParam(name, value string) (NodeOpts, error) {
+	var err error
+
+	switch name {
+	case "pool_min":
+		o.MinConnections, err = parseUint16(value)
+	case "pool_max":
+		o.MaxConnections, err = parseUint16(value)
+	case "idle_timeout":
+		o.IdleTimeout, err = time.ParseDuration(value)
+	case "connect_timeout":
+		o.ConnectTimeout, err = time.ParseDuration(value)
+	case "request_timeout":
+		o.RequestTimeout, err = time.ParseDuration(value)
+	case "health_check_interval":
+		o.HealthCheckInterval, err = time.ParseDuration(value)
+	default:
+		err = errors.New("unknown parameter")
+	}
+
+	return o, err
+}
+
+func parseUint16(value string) (uint16, error) {
+	i, err := strconv.ParseUint(value, 10, 16)
+	return uint16(i), err
+}
@@ -0,0 +1,116 @@
+package goriak
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRunContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var out []byte
+	_, err := Bucket("testsuite", "tests").GetRaw("cancelled", &out).RunContext(ctx, con())
+	if err != context.Canceled {
+		t.Error("unexpected error:", err)
+	}
+
+	_, err = Bucket("testsuite", "tests").SetRaw([]byte{1, 2, 3}).RunContext(ctx, con())
+	if err != context.Canceled {
+		t.Error("unexpected error:", err)
+	}
+
+	var res testmapobject
+	_, err = bucket().Get("cancelled", &res).RunContext(ctx, con())
+	if err != context.Canceled {
+		t.Error("unexpected error:", err)
+	}
+}
+
+func TestRunContextDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+
+	time.Sleep(time.Millisecond)
+
+	_, err := Bucket("testdelete", "default").Delete("deadline").RunContext(ctx, con())
+	if err != context.DeadlineExceeded {
+		t.Error("unexpected error:", err)
+	}
+}
+
+func TestAllKeysContextAbort(t *testing.T) {
+	c := con()
+
+	for i := 0; i < 10; i++ {
+		Bucket("testdelete", "default").SetRaw([]byte{1, 2, 3, 4}).Run(c)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	calls := 0
+
+	Bucket("testdelete", "default").AllKeys(func(res []string) error {
+		calls++
+		cancel()
+		return nil
+	}).RunContext(ctx, c)
+
+	if calls > 1 {
+		t.Error("callback was called after cancel")
+	}
+}
+
+func TestCounterExecContextCancelled(t *testing.T) {
+	type testType struct {
+		Foos *Counter
+	}
+
+	testVal := testType{}
+
+	_, err := bucket().Set(&testVal).Key(randomKey()).Run(con())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = testVal.Foos.Increase(1).ExecContext(ctx, con())
+	if err != context.Canceled {
+		t.Error("unexpected error:", err)
+	}
+}
+
+func TestMiddlewareContext(t *testing.T) {
+	type ctxKey struct{}
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "hello")
+
+	exec := false
+
+	m := func(cmd RunMiddlewarer, next func() (*Result, error)) (*Result, error) {
+		exec = true
+
+		if cmd.Context().Value(ctxKey{}) != "hello" {
+			t.Error("unexpected context")
+		}
+
+		return next()
+	}
+
+	_, err := Bucket("middleware", "tests").
+		RegisterRunMiddleware(m).
+		SetRaw([]byte{1, 2, 3}).
+		RunContext(ctx, con())
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !exec {
+		t.Error("middleware did not run")
+	}
+}
@@ -1,8 +1,8 @@
 package goriak
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 
 	riak "github.com/basho/riak-go-client"
 )
@@ -49,18 +49,22 @@ func (c *Counter) Value() int64 {
 // Exec only works on Counters initialized by GetMap()
 // If the commad succeeds the counter will be updated with the value in the response from Riak
 func (c *Counter) Exec(client *Session) error {
+	return c.ExecContext(context.Background(), client)
+}
 
+// ExecContext is the same as Exec, but aborts the request when ctx is cancelled or reaches its deadline
+func (c *Counter) ExecContext(ctx context.Context, client *Session) error {
 	if c == nil {
-		return errors.New("Nil Counter")
+		return uninitializedError("Nil Counter")
 	}
 
 	if c.name == "" {
-		return errors.New("Unknown path to Counter. Retrieve Counter with Get or Set before updating the Counter")
+		return uninitializedError("Unknown path to Counter. Retrieve Counter with Get or Set before updating the Counter")
 	}
 
 	// Validate c.key
 	if c.key.bucket == "" || c.key.bucketType == "" || c.key.key == "" {
-		return errors.New("Invalid key in Counter Exec()")
+		return uninitializedError("Invalid key in Counter Exec()")
 	}
 
 	op := &riak.MapOperation{}
@@ -73,36 +77,27 @@ func (c *Counter) Exec(client *Session) error {
 
 	op.IncrementCounter(c.name, c.increaseBy)
 
-	cmd, err := riak.NewUpdateMapCommandBuilder().
-		WithBucket(c.key.bucket).
-		WithBucketType(c.key.bucketType).
-		WithKey(c.key.key).
-		WithMapOperation(outerOp).
-		WithReturnBody(true).
-		Build()
-
-	if err != nil {
-		return err
+	req := &updateMapRequest{
+		bucket:     c.key.bucket,
+		bucketType: c.key.bucketType,
+		key:        c.key.key,
+		op:         outerOp,
+		returnBody: true,
 	}
 
-	err = client.riak.Execute(cmd)
+	err := c.execute(ctx, client, req)
 
 	if err != nil {
 		return err
 	}
 
-	res, ok := cmd.(*riak.UpdateMapCommand)
-
-	if !ok {
-		return errors.New("Could not convert")
-	}
-
-	if !res.Success() {
-		return errors.New("Not successful")
+	// The middleware did not execute the request
+	if req.response == nil {
+		return nil
 	}
 
 	// Update c.val from the response
-	m := res.Response.Map
+	m := req.response.Map
 
 	for _, subMapName := range c.path {
 		if _, ok := m.Maps[subMapName]; ok {
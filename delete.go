@@ -1,70 +1,75 @@
 package goriak
 
 import (
-	"errors"
-	riak "github.com/basho/riak-go-client"
+	"context"
 )
 
 type DeleteCommand struct {
-	c       *Command
-	builder *riak.DeleteValueCommandBuilder
+	c   *Command
+	req *deleteValueRequest
 }
 
 // Delete deletes the value stored as key
 func (c *Command) Delete(key string) *DeleteCommand {
-	builder := riak.NewDeleteValueCommandBuilder().
-		WithBucket(c.bucket).
-		WithBucketType(c.bucketType).
-		WithKey(key)
-
 	return &DeleteCommand{
-		c:       c,
-		builder: builder,
+		c: c,
+		req: &deleteValueRequest{
+			bucket:     c.bucket,
+			bucketType: c.bucketType,
+			key:        key,
+		},
 	}
 }
 
 func (c *DeleteCommand) WithDw(dw uint32) *DeleteCommand {
-	c.builder.WithDw(dw)
+	c.req.dw = dw
 	return c
 }
 
 // WithPw sets the number of primary nodes  that must report back a successful write for the command to be successful.
 func (c *DeleteCommand) WithPw(pw uint32) *DeleteCommand {
-	c.builder.WithPw(pw)
+	c.req.pw = pw
 	return c
 }
 
 func (c *DeleteCommand) WithPr(pr uint32) *DeleteCommand {
-	c.builder.WithPr(pr)
+	c.req.pr = pr
 	return c
 }
 
 func (c *DeleteCommand) WithR(r uint32) *DeleteCommand {
-	c.builder.WithR(r)
+	c.req.r = r
 	return c
 }
 
 // WithW sets the number of nodes that must report back a successful write for the command to be successful.
 func (c *DeleteCommand) WithW(w uint32) *DeleteCommand {
-	c.builder.WithW(w)
+	c.req.w = w
 	return c
 }
 
 func (c *DeleteCommand) Run(session *Session) (*Result, error) {
-	cmd, err := c.builder.Build()
-	if err != nil {
-		return nil, err
-	}
+	return c.RunContext(context.Background(), session)
+}
 
-	err = session.riak.Execute(cmd)
-	if err != nil {
-		return nil, err
+// RunContext is the same as Run, but aborts the command when ctx is cancelled or reaches its deadline
+func (c *DeleteCommand) RunContext(ctx context.Context, session *Session) (*Result, error) {
+	middlewarer := &commandMiddlewarer{
+		key:        c.req.key,
+		bucket:     c.c.bucket,
+		bucketType: c.c.bucketType,
+		ctx:        ctx,
+		operation:  OperationDelete,
+		quorum:     c.req.quorum,
 	}
 
-	res := cmd.(*riak.DeleteValueCommand)
+	return runMiddleware(ctx, middlewarer, c.c.runMiddleware, c.riakExec, session)
+}
 
-	if !res.Success() {
-		return nil, errors.New("not successful")
+func (c *DeleteCommand) riakExec(ctx context.Context, session *Session) (*Result, error) {
+	err := session.execute(ctx, c.req)
+	if err != nil {
+		return nil, err
 	}
 
 	return &Result{}, nil
@@ -0,0 +1,154 @@
+package goriak
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+
+	riak "github.com/basho/riak-go-client"
+)
+
+var (
+	// ErrNotFound is returned by Get and GetRaw (and the commands built on top of them)
+	// when the key does not exist in Riak.
+	ErrNotFound = errors.New("Not found")
+
+	// ErrNotSuccessful is returned when Riak reported that a command was not successful,
+	// without returning an error.
+	ErrNotSuccessful = errors.New("Not successful")
+
+	// ErrConflictUnresolved is returned when a value has siblings, and no conflict resolver has been set.
+	// Use ConflictResolver() on the command, or implement the ConflictResolver interface on the output type.
+	ErrConflictUnresolved = errors.New("goriak: Had conflict, but no conflict resolver")
+
+	// ErrInvalidResolverResult is returned when the conflict resolver returned a value without a VClock.
+	// Use ConflictObject.GetResolved() to create the result of the resolver.
+	ErrInvalidResolverResult = errors.New("goriak: Invalid value from conflict resolver")
+
+	// ErrUnsupportedType is matched by all *UnsupportedTypeError errors, and can be used with errors.Is.
+	ErrUnsupportedType = errors.New("goriak: unsupported type")
+
+	// ErrUninitialized is returned by Exec() on the helper types (Counter, Set, Flag and Register)
+	// if the helper has not been retrieved with Get or Set.
+	ErrUninitialized = errors.New("goriak: helper type is not initialized")
+
+	// ErrSessionClosed is returned by all commands that are executed on a Session
+	// after Close or Shutdown has been called.
+	ErrSessionClosed = errors.New("goriak: session is closed")
+
+	// ErrUnsupportedServerVersion is returned by Connect when CheckServerVersion is set,
+	// and a node is running a version of Riak that is older than 2.0.
+	ErrUnsupportedServerVersion = errors.New("goriak: unsupported Riak version, 2.0 or later is required")
+
+	// ErrCircuitOpen is matched by all *CircuitOpenError errors, returned by CircuitBreakerMiddleware
+	// when a command is rejected.
+	ErrCircuitOpen = errors.New("goriak: circuit breaker is open")
+
+	// ErrRateLimited is returned by RateLimitMiddleware when a command exceeds the rate limit,
+	// or when the rate limit can not be met before the deadline of the context.
+	ErrRateLimited = errors.New("goriak: rate limit exceeded")
+)
+
+// UnsupportedTypeError is returned when a Go value can not be converted to or from a Riak Map.
+// It matches ErrUnsupportedType when used with errors.Is.
+type UnsupportedTypeError struct {
+	// Path to the field in the Riak Map, separated by dots. Such as "User.Tags".
+	// Path is empty if the top level value has an unsupported type.
+	Path string
+
+	// Type is the unsupported type
+	Type reflect.Type
+
+	msg string
+	err error
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	return e.msg
+}
+
+// Unwrap returns the error from parsing the value, such as a *strconv.NumError
+func (e *UnsupportedTypeError) Unwrap() error {
+	return e.err
+}
+
+func (e *UnsupportedTypeError) Is(target error) bool {
+	return target == ErrUnsupportedType
+}
+
+func newUnsupportedTypeError(path []string, typ reflect.Type, msg string) error {
+	return &UnsupportedTypeError{
+		Path: strings.Join(path, "."),
+		Type: typ,
+		msg:  msg,
+	}
+}
+
+// wrapUnsupportedTypeError returns err as an *UnsupportedTypeError with the path to the field, err is kept as the message
+func wrapUnsupportedTypeError(path []string, typ reflect.Type, err error) error {
+	return &UnsupportedTypeError{
+		Path: strings.Join(path, "."),
+		Type: typ,
+		msg:  err.Error(),
+		err:  err,
+	}
+}
+
+// RiakError is returned when Riak responded to a command with an error.
+// The original error from riak-go-client can be retrieved with errors.Unwrap.
+type RiakError struct {
+	// Code and Message are the error code and the error message from Riak
+	Code    uint32
+	Message string
+
+	// Node is the address of the node that executed the command.
+	// Node is empty if the node is unknown.
+	Node string
+
+	err error
+}
+
+func (e *RiakError) Error() string {
+	return e.err.Error()
+}
+
+func (e *RiakError) Unwrap() error {
+	return e.err
+}
+
+// newRiakError returns err as a *RiakError if err contains an error from Riak.
+// The *CircuitOpenError from CircuitBreakerNodeManager is returned without the ClientError from riak-go-client.
+// All other errors are returned unmodified.
+func newRiakError(err error, node string) error {
+	for inner := err; inner != nil; {
+		switch e := inner.(type) {
+		case riak.RiakError:
+			return &RiakError{
+				Code:    e.Errcode,
+				Message: e.Errmsg,
+				Node:    node,
+				err:     err,
+			}
+		case *CircuitOpenError:
+			return e
+		case riak.ClientError:
+			inner = e.InnerError
+		default:
+			inner = nil
+		}
+	}
+
+	return err
+}
+
+// uninitializedError is used by the helper types, it keeps the original
+// error messages while still matching ErrUninitialized
+type uninitializedError string
+
+func (e uninitializedError) Error() string {
+	return string(e)
+}
+
+func (e uninitializedError) Is(target error) bool {
+	return target == ErrUninitialized
+}
@@ -0,0 +1,146 @@
+package goriak
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestErrNotFound(t *testing.T) {
+	var out []byte
+	res, err := Bucket("testsuite", "tests").GetRaw(randomKey(), &out).Run(con())
+	if !errors.Is(err, ErrNotFound) {
+		t.Error("unexpected error:", err)
+	}
+
+	if !res.NotFound {
+		t.Error("not marked as not found")
+	}
+
+	var val testmapobject
+	_, err = bucket().Get(randomKey(), &val).Run(con())
+	if !errors.Is(err, ErrNotFound) {
+		t.Error("unexpected error:", err)
+	}
+}
+
+func TestErrConflict(t *testing.T) {
+	key := randomKey()
+	c := con()
+
+	Bucket("sibs", "tests").SetRaw([]byte("a")).Key(key).Run(c)
+	Bucket("sibs", "tests").SetRaw([]byte("b")).Key(key).Run(c)
+
+	var out []byte
+	_, err := Bucket("sibs", "tests").GetRaw(key, &out).Run(c)
+	if !errors.Is(err, ErrConflictUnresolved) {
+		t.Error("unexpected error:", err)
+	}
+
+	_, err = Bucket("sibs", "tests").
+		GetRaw(key, &out).
+		ConflictResolver(func([]ConflictObject) ResolvedConflict {
+			return ResolvedConflict{}
+		}).
+		Run(c)
+	if !errors.Is(err, ErrInvalidResolverResult) {
+		t.Error("unexpected error:", err)
+	}
+}
+
+func TestErrUnsupportedType(t *testing.T) {
+	type sub struct {
+		Value uintptr
+	}
+
+	type testType struct {
+		Sub sub `goriak:"renamed"`
+	}
+
+	_, err := bucket().Set(testType{}).Key(randomKey()).Run(con())
+	if !errors.Is(err, ErrUnsupportedType) {
+		t.Error("unexpected error:", err)
+		return
+	}
+
+	var typeErr *UnsupportedTypeError
+	if !errors.As(err, &typeErr) {
+		t.Error("not an UnsupportedTypeError")
+		return
+	}
+
+	if typeErr.Path != "renamed.Value" {
+		t.Error("unexpected path:", typeErr.Path)
+	}
+
+	if typeErr.Type != reflect.TypeOf(uintptr(0)) {
+		t.Error("unexpected type:", typeErr.Type)
+	}
+
+	if err.Error() != "Unexpected type: uintptr" {
+		t.Error("unexpected message:", err.Error())
+	}
+}
+
+func TestErrUnsupportedTypeParse(t *testing.T) {
+	type writeType struct {
+		A string
+	}
+
+	result, err := bucket().Set(writeType{A: "abc"}).Run(con())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	type readType struct {
+		A int
+	}
+
+	_, err = bucket().Get(result.Key, &readType{}).Run(con())
+	if !errors.Is(err, ErrUnsupportedType) {
+		t.Error("unexpected error:", err)
+		return
+	}
+
+	var typeErr *UnsupportedTypeError
+	if !errors.As(err, &typeErr) || typeErr.Path != "A" || typeErr.Type != reflect.TypeOf(0) {
+		t.Error("unexpected error:", err)
+	}
+
+	var numErr *strconv.NumError
+	if !errors.As(err, &numErr) {
+		t.Error("not a strconv.NumError:", err)
+	}
+}
+
+func TestErrRiakError(t *testing.T) {
+	_, err := Bucket("testsuite", "default").SetRaw([]byte{1}).WithW(4).Run(con())
+
+	var riakErr *RiakError
+	if !errors.As(err, &riakErr) {
+		t.Error("not a RiakError:", err)
+		return
+	}
+
+	if riakErr.Message != "{n_val_violation,3}" {
+		t.Error("unexpected message:", riakErr.Message)
+	}
+
+	if errors.Unwrap(err) == nil {
+		t.Error("no wrapped error")
+	}
+}
+
+func TestErrUninitialized(t *testing.T) {
+	var counter *Counter
+	if err := counter.Increase(1).Exec(con()); !errors.Is(err, ErrUninitialized) {
+		t.Error("unexpected error:", err)
+	}
+
+	set := &Set{}
+	if err := set.AddString("a").Exec(con()); !errors.Is(err, ErrUninitialized) {
+		t.Error("unexpected error:", err)
+	}
+}
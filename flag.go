@@ -1,8 +1,8 @@
 package goriak
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 
 	riak "github.com/basho/riak-go-client"
 )
@@ -27,17 +27,22 @@ func (f *Flag) Set(val bool) *Flag {
 }
 
 func (f *Flag) Exec(client *Session) error {
+	return f.ExecContext(context.Background(), client)
+}
+
+// ExecContext is the same as Exec, but aborts the request when ctx is cancelled or reaches its deadline
+func (f *Flag) ExecContext(ctx context.Context, client *Session) error {
 	if f == nil {
-		return errors.New("Nil Flag")
+		return uninitializedError("Nil Flag")
 	}
 
 	if f.name == "" {
-		return errors.New("Unknown path to Flag. Retrieve Flag with Get or Set before updating the Flag")
+		return uninitializedError("Unknown path to Flag. Retrieve Flag with Get or Set before updating the Flag")
 	}
 
 	// Validate s.key
 	if f.key.bucket == "" || f.key.bucketType == "" || f.key.key == "" {
-		return errors.New("Invalid key in Flag Exec()")
+		return uninitializedError("Invalid key in Flag Exec()")
 	}
 
 	op := &riak.MapOperation{}
@@ -50,34 +55,20 @@ func (f *Flag) Exec(client *Session) error {
 
 	op.SetFlag(f.name, f.val)
 
-	cmd, err := riak.NewUpdateMapCommandBuilder().
-		WithBucket(f.key.bucket).
-		WithBucketType(f.key.bucketType).
-		WithKey(f.key.key).
-		WithMapOperation(outerOp).
-		WithContext(f.context).
-		Build()
-
-	if err != nil {
-		return err
+	req := &updateMapRequest{
+		bucket:     f.key.bucket,
+		bucketType: f.key.bucketType,
+		key:        f.key.key,
+		op:         outerOp,
+		context:    f.context,
 	}
 
-	err = client.riak.Execute(cmd)
+	err := f.execute(ctx, client, req)
 
 	if err != nil {
 		return err
 	}
 
-	res, ok := cmd.(*riak.UpdateMapCommand)
-
-	if !ok {
-		return errors.New("Could not convert")
-	}
-
-	if !res.Success() {
-		return errors.New("Not successful")
-	}
-
 	return nil
 }
 
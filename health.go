@@ -0,0 +1,52 @@
+package goriak
+
+import (
+	"context"
+)
+
+// NodeState is the state of a Riak node, as reported by riak-go-client
+type NodeState string
+
+const (
+	NodeCreated        NodeState = "created"         // The node has not been started yet
+	NodeRunning        NodeState = "running"         // The node is available
+	NodeHealthChecking NodeState = "health-checking" // The node is unavailable, and is being health checked until it recovers
+	NodeShuttingDown   NodeState = "shutting-down"   // The node is stopping
+	NodeShutdown       NodeState = "shutdown"        // The node has been stopped
+	NodeUnknown        NodeState = "unknown"         // The state could not be read from riak-go-client
+)
+
+// NodeHealth is the health of a single Riak node
+type NodeHealth struct {
+	Address string
+	State   NodeState
+}
+
+// Health is the health of all nodes in a Session
+type Health struct {
+	Nodes []NodeHealth
+}
+
+// Healthy returns true if at least one node is running
+func (h Health) Healthy() bool {
+	for _, node := range h.Nodes {
+		if node.State == NodeRunning {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Ping sends a ping to Riak, and returns an error if Riak could not be reached before ctx is done.
+func (c *Session) Ping(ctx context.Context) error {
+	return c.execute(ctx, &pingRequest{})
+}
+
+// Health returns the current state of all nodes in the Session.
+// Nodes that are unavailable are health checked by riak-go-client until they recover.
+func (c *Session) Health() Health {
+	return Health{
+		Nodes: c.backend.health(),
+	}
+}
@@ -0,0 +1,85 @@
+package goriak
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	riak "github.com/basho/riak-go-client"
+)
+
+func TestPing(t *testing.T) {
+	err := con().Ping(context.Background())
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	c, err := Connect(ConnectOpts{
+		Addresses: []string{"127.0.0.1"},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	health := c.Health()
+
+	if !health.Healthy() {
+		t.Errorf("not healthy: %+v", health)
+	}
+
+	if len(health.Nodes) != 1 || health.Nodes[0].Address != "127.0.0.1:8087" {
+		t.Errorf("unexpected nodes: %+v", health.Nodes)
+	}
+
+	c.Close()
+
+	health = c.Health()
+
+	if health.Healthy() || health.Nodes[0].State != NodeShutdown {
+		t.Errorf("unexpected health after Close: %+v", health)
+	}
+}
+
+func TestNodeState(t *testing.T) {
+	node, err := riak.NewNode(&riak.NodeOptions{
+		RemoteAddress: "127.0.0.1:8087",
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if state := nodeState(node); state != NodeCreated {
+		t.Error("unexpected state:", state)
+	}
+
+	if address := nodeAddress(reflect.ValueOf(node)); address != "127.0.0.1:8087" {
+		t.Error("unexpected address:", address)
+	}
+}
+
+func TestMemorySessionHealth(t *testing.T) {
+	c := NewMemorySession()
+
+	if err := c.Ping(context.Background()); err != nil {
+		t.Error(err)
+	}
+
+	if !c.Health().Healthy() {
+		t.Error("not healthy")
+	}
+
+	c.Close()
+
+	if c.Health().Healthy() {
+		t.Error("healthy after Close")
+	}
+
+	if err := c.Ping(context.Background()); !errors.Is(err, ErrSessionClosed) {
+		t.Error("unexpected error:", err)
+	}
+}
@@ -1,14 +1,13 @@
 package goriak
 
 import (
-	riak "github.com/basho/riak-go-client"
-
-	"errors"
+	"context"
 )
 
 type FetchHyperLogLogCommand struct {
-	builder *riak.FetchHllCommandBuilder
-	key     string
+	c   *Command
+	req *fetchHllRequest
+	key string
 }
 
 type HyperLogLogResult struct {
@@ -18,50 +17,82 @@ type HyperLogLogResult struct {
 }
 
 func (c *Command) GetHyperLogLog(key string) *FetchHyperLogLogCommand {
-	b := riak.NewFetchHllCommandBuilder().
-		WithBucket(c.bucket).
-		WithBucketType(c.bucketType).
-		WithKey(key)
-
 	return &FetchHyperLogLogCommand{
-		builder: b,
-		key:     key,
+		c: c,
+		req: &fetchHllRequest{
+			bucket:     c.bucket,
+			bucketType: c.bucketType,
+			key:        key,
+		},
+		key: key,
 	}
 }
 
 func (c *FetchHyperLogLogCommand) WithPr(pr uint32) *FetchHyperLogLogCommand {
-	c.builder.WithPr(pr)
+	c.req.pr = pr
 	return c
 
 }
 func (c *FetchHyperLogLogCommand) WithR(r uint32) *FetchHyperLogLogCommand {
-	c.builder.WithPr(r)
+	c.req.r = r
 	return c
 }
 
 func (c *FetchHyperLogLogCommand) Run(session *Session) (*HyperLogLogResult, error) {
-	cmd, err := c.builder.Build()
-	if err != nil {
-		return nil, err
+	return c.RunContext(context.Background(), session)
+}
+
+// RunContext is the same as Run, but aborts the command when ctx is cancelled or reaches its deadline
+func (c *FetchHyperLogLogCommand) RunContext(ctx context.Context, session *Session) (*HyperLogLogResult, error) {
+	middlewarer := &commandMiddlewarer{
+		key:        c.key,
+		bucket:     c.c.bucket,
+		bucketType: c.c.bucketType,
+		ctx:        ctx,
+		operation:  OperationGetHyperLogLog,
+		quorum:     c.req.quorum,
 	}
 
-	err = session.riak.Execute(cmd)
+	var res *HyperLogLogResult
+
+	result, err := runMiddleware(ctx, middlewarer, c.c.runMiddleware, func(ctx context.Context, session *Session) (*Result, error) {
+		var err error
+
+		res, err = c.riakExec(ctx, session)
+		if err != nil {
+			return nil, err
+		}
+
+		return &Result{
+			Key:      res.Key,
+			NotFound: res.NotFound,
+		}, nil
+	}, session)
 	if err != nil {
 		return nil, err
 	}
 
-	res, ok := cmd.(*riak.FetchHllCommand)
-	if !ok {
-		return nil, errors.New("Could not convert result")
+	// The middleware did not execute the command
+	if res == nil {
+		res = &HyperLogLogResult{Key: c.key}
+
+		if result != nil {
+			res.NotFound = result.NotFound
+		}
 	}
 
-	if !res.Success() {
-		return nil, errors.New("Execution not successful")
+	return res, nil
+}
+
+func (c *FetchHyperLogLogCommand) riakExec(ctx context.Context, session *Session) (*HyperLogLogResult, error) {
+	err := session.execute(ctx, c.req)
+	if err != nil {
+		return nil, err
 	}
 
 	return &HyperLogLogResult{
-		NotFound:    res.Response.IsNotFound,
-		Cardinality: res.Response.Cardinality,
+		NotFound:    c.req.response.IsNotFound,
+		Cardinality: c.req.response.Cardinality,
 		Key:         c.key,
 	}, nil
 }
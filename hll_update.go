@@ -1,98 +1,135 @@
 package goriak
 
 import (
-	"errors"
-	riak "github.com/basho/riak-go-client"
+	"context"
 )
 
 type UpdateHyperLogLogCommand struct {
-	builder    *riak.UpdateHllCommandBuilder
+	c          *Command
+	req        *updateHllRequest
 	returnBody bool
 	key        string
 }
 
 func (c *Command) UpdateHyperLogLog() *UpdateHyperLogLogCommand {
-	b := riak.NewUpdateHllCommandBuilder().
-		WithBucket(c.bucket).
-		WithBucketType(c.bucketType)
-
 	return &UpdateHyperLogLogCommand{
-		builder: b,
+		c: c,
+		req: &updateHllRequest{
+			bucket:     c.bucket,
+			bucketType: c.bucketType,
+		},
 	}
 }
 
 func (c *UpdateHyperLogLogCommand) Add(val []byte) *UpdateHyperLogLogCommand {
-	c.builder.WithAdditions(val)
+	c.req.additions = append(c.req.additions, val)
 	return c
 }
 
 func (c *UpdateHyperLogLogCommand) AddMultiple(vals ...[]byte) *UpdateHyperLogLogCommand {
-	c.builder.WithAdditions(vals...)
+	c.req.additions = append(c.req.additions, vals...)
 	return c
 }
 
 func (c *UpdateHyperLogLogCommand) Key(key string) *UpdateHyperLogLogCommand {
-	c.builder.WithKey(key)
+	c.req.key = key
 	c.key = key
 	return c
 }
 
 // WithPw sets the number of primary nodes  that must report back a successful write for the command to be successful.
 func (c *UpdateHyperLogLogCommand) WithPw(pw uint32) *UpdateHyperLogLogCommand {
-	c.builder.WithPw(pw)
+	c.req.pw = pw
 	return c
 }
 
 // WithDw sets the number of nodes that must report back a successful write to their backend storage for the command to be successful.
 func (c *UpdateHyperLogLogCommand) WithDw(dw uint32) *UpdateHyperLogLogCommand {
-	c.builder.WithDw(dw)
+	c.req.dw = dw
 	return c
 }
 
 // WithW sets the number of nodes that must report back a successful write for the command to be successful.
 func (c *UpdateHyperLogLogCommand) WithW(w uint32) *UpdateHyperLogLogCommand {
-	c.builder.WithW(w)
+	c.req.w = w
 	return c
 }
 
 func (c *UpdateHyperLogLogCommand) ReturnBody(returnBody bool) *UpdateHyperLogLogCommand {
-	c.builder.WithReturnBody(returnBody)
+	c.req.returnBody = returnBody
 	c.returnBody = returnBody
 	return c
 }
 
 // Run executes the command. If ReturnBody() is not set to true the result will be nil.
 func (c *UpdateHyperLogLogCommand) Run(session *Session) (*HyperLogLogResult, error) {
-	cmd, err := c.builder.Build()
-	if err != nil {
-		return nil, err
+	return c.RunContext(context.Background(), session)
+}
+
+// RunContext is the same as Run, but aborts the command when ctx is cancelled or reaches its deadline
+func (c *UpdateHyperLogLogCommand) RunContext(ctx context.Context, session *Session) (*HyperLogLogResult, error) {
+	middlewarer := &commandMiddlewarer{
+		key:        c.key,
+		bucket:     c.c.bucket,
+		bucketType: c.c.bucketType,
+		ctx:        ctx,
+		operation:  OperationUpdateHyperLogLog,
+		quorum:     c.req.quorum,
+
+		nonIdempotent: true,
 	}
 
-	err = session.riak.Execute(cmd)
+	for _, val := range c.req.additions {
+		middlewarer.size += len(val)
+	}
+
+	var res *HyperLogLogResult
+
+	result, err := runMiddleware(ctx, middlewarer, c.c.runMiddleware, func(ctx context.Context, session *Session) (*Result, error) {
+		var err error
+
+		res, err = c.riakExec(ctx, session)
+		if err != nil {
+			return nil, err
+		}
+
+		return &Result{
+			Key: res.Key,
+		}, nil
+	}, session)
 	if err != nil {
 		return nil, err
 	}
 
-	res, ok := cmd.(*riak.UpdateHllCommand)
-	if !ok {
-		return nil, errors.New("Could not convert result")
+	if !c.returnBody {
+		return nil, nil
 	}
 
-	if !res.Success() {
-		return nil, errors.New("Execution not successful")
+	// The middleware did not execute the command
+	if res == nil {
+		res = &HyperLogLogResult{Key: c.key}
+
+		if result != nil && result.Key != "" {
+			res.Key = result.Key
+		}
 	}
 
-	if !c.returnBody {
-		return nil, nil
+	return res, nil
+}
+
+func (c *UpdateHyperLogLogCommand) riakExec(ctx context.Context, session *Session) (*HyperLogLogResult, error) {
+	err := session.execute(ctx, c.req)
+	if err != nil {
+		return nil, err
 	}
 
 	key := c.key
 	if c.key == "" {
-		key = res.Response.GeneratedKey
+		key = c.req.response.GeneratedKey
 	}
 
 	return &HyperLogLogResult{
 		Key:         key,
-		Cardinality: res.Response.Cardinality,
+		Cardinality: c.req.response.Cardinality,
 	}, nil
 }
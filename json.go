@@ -2,7 +2,6 @@ package goriak
 
 import (
 	"encoding/json"
-	"errors"
 	"reflect"
 	"strconv"
 
@@ -21,7 +20,7 @@ func (c *Command) SetJSON(value interface{}) *SetRawCommand {
 		return cmdSet
 	}
 
-	object := riak.Object{
+	object := &riak.Object{
 		Value: by,
 	}
 
@@ -83,8 +82,16 @@ func (c *Command) SetJSON(value interface{}) *SetRawCommand {
 						object.AddToIndex(indexName, strconv.FormatInt(sliceValue.Index(sli).Int(), 10))
 					}
 
+				// []float64
+				case reflect.Float32:
+					fallthrough
+				case reflect.Float64:
+					for sli := 0; sli < sliceValue.Len(); sli++ {
+						object.AddToIndex(indexName, formatFloat(sliceValue.Index(sli)))
+					}
+
 				default:
-					cmdSet.err = errors.New("Did not know how to set index: " + refType.Field(i).Name)
+					cmdSet.err = newUnsupportedTypeError([]string{refType.Field(i).Name}, refType.Field(i).Type, "Did not know how to set index: "+refType.Field(i).Name)
 					return cmdSet
 				}
 
@@ -106,30 +113,30 @@ func (c *Command) SetJSON(value interface{}) *SetRawCommand {
 					strconv.FormatInt(refValue.Field(i).Int(), 10),
 				)
 
+			// Float
+			case reflect.Float32:
+				fallthrough
+			case reflect.Float64:
+				object.AddToIndex(indexName, formatFloat(refValue.Field(i)))
+
 			default:
-				cmdSet.err = errors.New("Did not know how to set index: " + refType.Field(i).Name)
+				cmdSet.err = newUnsupportedTypeError([]string{refType.Field(i).Name}, refType.Field(i).Type, "Did not know how to set index: "+refType.Field(i).Name)
 				return cmdSet
 			}
 		}
 	}
 
-	builder := riak.NewStoreValueCommandBuilder().
-		WithBucket(c.bucket).
-		WithBucketType(c.bucketType)
-
-	cmdSet.storeValueObject = &object
-	cmdSet.storeValueCommandBuilder = builder
+	cmdSet.req = &storeValueRequest{
+		bucket:     c.bucket,
+		bucketType: c.bucketType,
+		object:     object,
+	}
 
 	return cmdSet
 }
 
 // GetJSON is the same as GetRaw, but with automatic JSON unmarshalling
 func (c *Command) GetJSON(key string, output interface{}) *GetRawCommand {
-	builder := riak.NewFetchValueCommandBuilder().
-		WithBucket(c.bucket).
-		WithBucketType(c.bucketType).
-		WithKey(key)
-
 	return &GetRawCommand{
 		c:   c,
 		key: key,
@@ -137,7 +144,11 @@ func (c *Command) GetJSON(key string, output interface{}) *GetRawCommand {
 		bucket:     c.bucket,
 		bucketType: c.bucketType,
 
-		builder: builder,
-		output:  output,
+		req: &fetchValueRequest{
+			bucket:     c.bucket,
+			bucketType: c.bucketType,
+			key:        key,
+		},
+		output: output,
 	}
 }
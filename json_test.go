@@ -440,3 +440,50 @@ func TestJSONUnknownIndex(t *testing.T) {
 		t.Error("Unexpected error:", err.Error())
 	}
 }
+
+func TestJSONFloatIndex(t *testing.T) {
+	type testType struct {
+		User   string
+		Price  float64   `goriakindex:"pricefloat_bin"`
+		Scores []float32 `goriakindex:"scoresfloat_bin"`
+	}
+
+	key := randomKey()
+
+	_, err := Bucket("json", "default").
+		SetJSON(testType{
+			User:   "A",
+			Price:  19.99,
+			Scores: []float32{0.1, 2.5},
+		}).
+		Key(key).
+		Run(con())
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for _, tc := range []struct {
+		index string
+		value string
+	}{
+		{"pricefloat_bin", "19.99"},
+		{"scoresfloat_bin", "0.1"},
+		{"scoresfloat_bin", "2.5"},
+	} {
+		found := false
+
+		cb := func(res SecondaryIndexQueryResult) {
+			if res.Key == key {
+				found = true
+			}
+		}
+
+		Bucket("json", "default").KeysInIndex(tc.index, tc.value, cb).Run(con())
+
+		if !found {
+			t.Error("not found in index:", tc.index, tc.value)
+		}
+	}
+}
@@ -1,7 +1,8 @@
 package goriak
 
 import (
-	"errors"
+	"context"
+
 	riak "github.com/basho/riak-go-client"
 )
 
@@ -13,16 +14,31 @@ type SecondaryIndexQueryResult struct {
 }
 
 type CommandKeysInIndex struct {
-	c       *Command
-	builder *riak.SecondaryIndexQueryCommandBuilder
+	c        *Command
+	req      *secondaryIndexRequest
+	callback func(SecondaryIndexQueryResult)
 }
 
 type KeysInIndexResult struct {
 	Continuation []byte
 }
 
-func (c *Command) commonIndexBuilder(indexName string, callback func(SecondaryIndexQueryResult)) *riak.SecondaryIndexQueryCommandBuilder {
-	cb := func(res []*riak.SecondaryIndexQueryResult) error {
+func (c *Command) commonIndexRequest(indexName string) *secondaryIndexRequest {
+	return &secondaryIndexRequest{
+		bucket:     c.bucket,
+		bucketType: c.bucketType,
+		indexName:  indexName,
+	}
+}
+
+// indexCallback converts the results from Riak to SecondaryIndexQueryResults.
+// The stream is aborted when ctx is done.
+func indexCallback(ctx context.Context, callback func(SecondaryIndexQueryResult)) func([]*riak.SecondaryIndexQueryResult) error {
+	return func(res []*riak.SecondaryIndexQueryResult) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		if len(res) == 0 {
 			callback(SecondaryIndexQueryResult{
 				Key:        "",
@@ -39,70 +55,106 @@ func (c *Command) commonIndexBuilder(indexName string, callback func(SecondaryIn
 
 		return nil
 	}
-
-	return riak.NewSecondaryIndexQueryCommandBuilder().
-		WithBucket(c.bucket).
-		WithBucketType(c.bucketType).
-		WithIndexName(indexName).
-		WithStreaming(true).
-		WithCallback(cb)
 }
 
 // KeysInIndex returns all keys in the index indexName that has the value indexValue
 // The values will be returned to the callbak function
 // When all keys have been returned SecondaryIndexQueryResult.IsComplete will be true
 func (c *Command) KeysInIndex(indexName, indexValue string, callback func(SecondaryIndexQueryResult)) *CommandKeysInIndex {
-	builder := c.commonIndexBuilder(indexName, callback)
-	builder = builder.WithIndexKey(indexValue)
+	req := c.commonIndexRequest(indexName)
+	req.indexKey = indexValue
 
 	return &CommandKeysInIndex{
-		c:       c,
-		builder: builder,
+		c:        c,
+		req:      req,
+		callback: callback,
 	}
 }
 
 // KeysInIndexRange is similar to KeysInIndex(), but works with with a range of index values
 func (c *Command) KeysInIndexRange(indexName, min, max string, callback func(SecondaryIndexQueryResult)) *CommandKeysInIndex {
-	builder := c.commonIndexBuilder(indexName, callback)
-	builder = builder.WithRange(min, max)
+	req := c.commonIndexRequest(indexName)
+	req.isRange = true
+	req.rangeMin = min
+	req.rangeMax = max
 
 	return &CommandKeysInIndex{
-		c:       c,
-		builder: builder,
+		c:        c,
+		req:      req,
+		callback: callback,
 	}
 }
 
 // Limit sets the limit returned in KeysInIndex
 // A limit of 0 means unlimited
 func (c *CommandKeysInIndex) Limit(limit uint32) *CommandKeysInIndex {
-	c.builder.WithMaxResults(limit)
+	c.req.maxResults = limit
 	return c
 }
 
 func (c *CommandKeysInIndex) IndexContinuation(continuation []byte) *CommandKeysInIndex {
-	c.builder.WithContinuation(continuation)
+	c.req.continuation = continuation
 	return c
 }
 
 func (c *CommandKeysInIndex) Run(session *Session) (*KeysInIndexResult, error) {
-	// Build it!
-	cmd, err := c.builder.Build()
-	if err != nil {
-		return nil, err
+	return c.RunContext(context.Background(), session)
+}
+
+// RunContext is the same as Run, but aborts the command when ctx is cancelled or reaches its deadline.
+// The stream of keys is aborted as soon as ctx is done, and the callback will not be called again.
+func (c *CommandKeysInIndex) RunContext(ctx context.Context, session *Session) (*KeysInIndexResult, error) {
+	middlewarer := &commandMiddlewarer{
+		bucket:     c.c.bucket,
+		bucketType: c.c.bucketType,
+		ctx:        ctx,
+		operation:  OperationKeysInIndex,
+		index: IndexQuery{
+			Name:    c.req.indexName,
+			Value:   c.req.indexKey,
+			IsRange: c.req.isRange,
+			Min:     c.req.rangeMin,
+			Max:     c.req.rangeMax,
+		},
 	}
 
-	err = session.riak.Execute(cmd)
+	if c.req.isRange {
+		middlewarer.operation = OperationKeysInIndexRange
+	}
+
+	var res *KeysInIndexResult
+
+	_, err := runMiddleware(ctx, middlewarer, c.c.runMiddleware, func(ctx context.Context, session *Session) (*Result, error) {
+		var err error
+
+		res, err = c.riakExec(ctx, session)
+		if err != nil {
+			return nil, err
+		}
+
+		return &Result{}, nil
+	}, session)
 	if err != nil {
 		return nil, err
 	}
 
-	res := cmd.(*riak.SecondaryIndexQueryCommand)
+	// The middleware did not execute the command
+	if res == nil {
+		res = &KeysInIndexResult{}
+	}
 
-	if !res.Success() {
-		return nil, errors.New("not successful")
+	return res, nil
+}
+
+func (c *CommandKeysInIndex) riakExec(ctx context.Context, session *Session) (*KeysInIndexResult, error) {
+	c.req.callback = indexCallback(ctx, c.callback)
+
+	err := session.execute(ctx, c.req)
+	if err != nil {
+		return nil, err
 	}
 
 	return &KeysInIndexResult{
-		Continuation: res.Response.Continuation,
+		Continuation: c.req.response.Continuation,
 	}, nil
 }
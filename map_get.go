@@ -1,94 +1,76 @@
 package goriak
 
 import (
-	"errors"
-	riak "github.com/basho/riak-go-client"
+	"context"
 )
 
 type MapGetCommand struct {
-	c       *Command
-	output  interface{}
-	key     string
-	builder *riak.FetchMapCommandBuilder
+	c      *Command
+	output interface{}
+	key    string
+	req    *fetchMapRequest
 }
 
 // Get retreives a Map from Riak.
 // Get performs automatic conversion from Riak Maps to your Go datatype.
 // See Set() for more information.
 func (c *Command) Get(key string, output interface{}) *MapGetCommand {
-	builder := riak.NewFetchMapCommandBuilder().
-		WithBucket(c.bucket).
-		WithBucketType(c.bucketType).
-		WithKey(key)
-
 	return &MapGetCommand{
-		c:       c,
-		output:  output,
-		key:     key,
-		builder: builder,
+		c:      c,
+		output: output,
+		key:    key,
+		req: &fetchMapRequest{
+			bucket:     c.bucket,
+			bucketType: c.bucketType,
+			key:        key,
+		},
 	}
 }
 
 func (c *MapGetCommand) Run(session *Session) (*Result, error) {
-	middlewarer := &getMiddlewarer{
-		cmd: c,
-	}
-
-	return runMiddleware(middlewarer, c.c.runMiddleware, c.riakExec, session)
+	return c.RunContext(context.Background(), session)
 }
 
-func (c *MapGetCommand) riakExec(session *Session) (*Result, error) {
-	cmd, err := c.builder.Build()
-	if err != nil {
-		return nil, err
+// RunContext is the same as Run, but aborts the command when ctx is cancelled or reaches its deadline
+func (c *MapGetCommand) RunContext(ctx context.Context, session *Session) (*Result, error) {
+	middlewarer := &commandMiddlewarer{
+		key:        c.key,
+		bucket:     c.c.bucket,
+		bucketType: c.c.bucketType,
+		ctx:        ctx,
+		operation:  OperationGet,
+		quorum:     c.req.quorum,
 	}
 
-	err = session.riak.Execute(cmd)
+	return runMiddleware(ctx, middlewarer, c.c.runMiddleware, c.riakExec, session)
+}
+
+func (c *MapGetCommand) riakExec(ctx context.Context, session *Session) (*Result, error) {
+	err := session.execute(ctx, c.req)
 	if err != nil {
 		return nil, err
 	}
 
-	mapCommand := cmd.(*riak.FetchMapCommand)
-
-	if !mapCommand.Success() {
-		return nil, errors.New("Not successful")
-	}
-
-	if mapCommand.Response.IsNotFound {
+	if c.req.response.IsNotFound {
 		return &Result{
 			NotFound: true,
-		}, errors.New("Not found")
+		}, ErrNotFound
 	}
 
 	req := requestData{
-		bucket:     c.c.bucket,
-		bucketType: c.c.bucketType,
-		key:        c.key,
+		bucket:        c.c.bucket,
+		bucketType:    c.c.bucketType,
+		key:           c.key,
+		runMiddleware: c.c.runMiddleware,
 	}
 
-	err = decodeInterface(mapCommand.Response, c.output, req)
+	err = decodeInterface(c.req.response, c.output, req)
 	if err != nil {
 		return nil, err
 	}
 
 	return &Result{
 		Key:     c.key,
-		Context: mapCommand.Response.Context,
+		Context: c.req.response.Context,
 	}, nil
 }
-
-type getMiddlewarer struct {
-	cmd *MapGetCommand
-}
-
-func (c *getMiddlewarer) Key() string {
-	return c.cmd.key
-}
-
-func (c *getMiddlewarer) Bucket() string {
-	return c.cmd.c.bucket
-}
-
-func (c *getMiddlewarer) BucketType() string {
-	return c.cmd.c.bucketType
-}
@@ -1,53 +1,64 @@
 package goriak
 
 import (
-	"errors"
+	"context"
+	"reflect"
+
 	riak "github.com/basho/riak-go-client"
 )
 
 type MapOperationCommand struct {
-	c       *Command
-	builder *riak.UpdateMapCommandBuilder
+	c   *Command
+	req *updateMapRequest
 }
 
 // MapOperation takes a riak.MapOperation so that you can run custom commands on your Riak Maps
 func (c *Command) MapOperation(op riak.MapOperation) *MapOperationCommand {
-	builder := riak.NewUpdateMapCommandBuilder().
-		WithBucket(c.bucket).
-		WithBucketType(c.bucketType).
-		WithMapOperation(&op)
-
 	return &MapOperationCommand{
-		c:       c,
-		builder: builder,
+		c: c,
+		req: &updateMapRequest{
+			bucket:     c.bucket,
+			bucketType: c.bucketType,
+			op:         &op,
+		},
 	}
 }
 
 func (c *MapOperationCommand) Context(ctx []byte) *MapOperationCommand {
-	c.builder.WithContext(ctx)
+	c.req.context = ctx
 	return c
 }
 
 func (c *MapOperationCommand) Key(key string) *MapOperationCommand {
-	c.builder.WithKey(key)
+	c.req.key = key
 	return c
 }
 
 func (c *MapOperationCommand) Run(session *Session) (*Result, error) {
-	cmd, err := c.builder.Build()
-	if err != nil {
-		return nil, err
-	}
+	return c.RunContext(context.Background(), session)
+}
 
-	err = session.riak.Execute(cmd)
-	if err != nil {
-		return nil, err
+// RunContext is the same as Run, but aborts the command when ctx is cancelled or reaches its deadline
+func (c *MapOperationCommand) RunContext(ctx context.Context, session *Session) (*Result, error) {
+	middlewarer := &commandMiddlewarer{
+		key:        c.req.key,
+		bucket:     c.c.bucket,
+		bucketType: c.c.bucketType,
+		ctx:        ctx,
+		operation:  OperationMapOperation,
+		quorum:     c.req.quorum,
+		size:       mapOperationSize(reflect.ValueOf(c.req.op)),
+
+		nonIdempotent: mapOperationIncrements(reflect.ValueOf(c.req.op)),
 	}
 
-	res := cmd.(*riak.UpdateMapCommand)
+	return runMiddleware(ctx, middlewarer, c.c.runMiddleware, c.riakExec, session)
+}
 
-	if !res.Success() {
-		return nil, errors.New("Not successful")
+func (c *MapOperationCommand) riakExec(ctx context.Context, session *Session) (*Result, error) {
+	err := session.execute(ctx, c.req)
+	if err != nil {
+		return nil, err
 	}
 
 	return &Result{}, nil
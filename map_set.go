@@ -1,7 +1,9 @@
 package goriak
 
 import (
-	"errors"
+	"context"
+	"reflect"
+
 	riak "github.com/basho/riak-go-client"
 )
 
@@ -9,6 +11,9 @@ type requestData struct {
 	bucket     string
 	bucketType string
 	key        string
+
+	// Middleware used by helpers (Counter, Set, etc.) when they are executed
+	runMiddleware []RunMiddleware
 }
 
 type MapSetCommand struct {
@@ -19,7 +24,7 @@ type MapSetCommand struct {
 	key        string
 	input      interface{}
 
-	builder *riak.UpdateMapCommandBuilder
+	req *updateMapRequest
 
 	includeFilter [][]string
 	excludeFilter [][]string
@@ -37,26 +42,29 @@ Set automatically converts your Go datatype to the equivalent type in Riak
 	| []slice    | set       |
 	| []slice    | set       |
 	| [][]byte   | set       |
+	| []struct   | set       |
 	| map        | map       |
 	| time.Time  | register  |
+
+Types that implement encoding.BinaryMarshaler or encoding.TextMarshaler are saved as registers,
+and types that implement RiakMapMarshaler are saved as maps.
 */
 func (c *Command) Set(val interface{}) *MapSetCommand {
-	builder := riak.NewUpdateMapCommandBuilder().
-		WithBucket(c.bucket).
-		WithBucketType(c.bucketType)
-
 	return &MapSetCommand{
 		c:          c,
 		input:      val,
 		bucket:     c.bucket,
 		bucketType: c.bucketType,
-		builder:    builder,
+		req: &updateMapRequest{
+			bucket:     c.bucket,
+			bucketType: c.bucketType,
+		},
 	}
 }
 
 func (c *MapSetCommand) Key(key string) *MapSetCommand {
 	c.key = key
-	c.builder.WithKey(key)
+	c.req.key = key
 	return c
 }
 
@@ -126,66 +134,93 @@ func filterMapOperation(cmd *MapSetCommand, input *riakMapOperation, path []stri
 
 // WithPw sets the number of primary nodes  that must report back a successful write for the command to be successful.
 func (c *MapSetCommand) WithPw(pw uint32) *MapSetCommand {
-	c.builder.WithPw(pw)
+	c.req.pw = pw
 	return c
 }
 
 // WithDw sets the number of nodes that must report back a successful write to their backend storage for the command to be successful.
 func (c *MapSetCommand) WithDw(dw uint32) *MapSetCommand {
-	c.builder.WithDw(dw)
+	c.req.dw = dw
 	return c
 }
 
 // WithW sets the number of nodes that must report back a successful write for the command to be successful.
 func (c *MapSetCommand) WithW(w uint32) *MapSetCommand {
-	c.builder.WithW(w)
+	c.req.w = w
 	return c
 }
 
 func (c *MapSetCommand) Run(session *Session) (*Result, error) {
-	middlewarer := &setMiddlewarer{
-		cmd: c,
-	}
-
-	return runMiddleware(middlewarer, c.c.runMiddleware, c.riakExec, session)
+	return c.RunContext(context.Background(), session)
 }
 
-func (c *MapSetCommand) riakExec(session *Session) (*Result, error) {
-	riakContext, op, err := encodeInterface(c.input, requestData{
+// RunContext is the same as Run, but aborts the command when ctx is cancelled or reaches its deadline
+func (c *MapSetCommand) RunContext(ctx context.Context, session *Session) (*Result, error) {
+	// The value is encoded before the middleware runs, so that the middleware can see the size of the operation.
+	// Encoding does not modify the input, and errors are returned through the middleware.
+	initHelpers, encodeErr := c.encode()
+
+	middlewarer := &commandMiddlewarer{
+		key:        c.key,
 		bucket:     c.bucket,
 		bucketType: c.bucketType,
-		key:        c.key,
-	})
+		ctx:        ctx,
+		operation:  OperationSet,
+		quorum:     c.req.quorum,
+		size:       mapOperationSize(reflect.ValueOf(c.req.op)),
+
+		// Riak generates a new key every time a value without a key is saved
+		nonIdempotent: c.key == "" || mapOperationIncrements(reflect.ValueOf(c.req.op)),
+	}
+
+	return runMiddleware(ctx, middlewarer, c.c.runMiddleware, func(ctx context.Context, session *Session) (*Result, error) {
+		if encodeErr != nil {
+			return nil, encodeErr
+		}
+
+		res, err := c.riakExec(ctx, session)
+		if err != nil {
+			return nil, err
+		}
+
+		// The helpers in the input are initialized when the value has been saved, with the generated key if the
+		// value was saved without a key
+		initHelpers(requestData{
+			bucket:        c.bucket,
+			bucketType:    c.bucketType,
+			key:           res.Key,
+			runMiddleware: c.c.runMiddleware,
+		})
+
+		return res, nil
+	}, session)
+}
+
+// encode converts c.input to the map operation and context in c.req.
+// initHelpers initializes the nil helpers (Counter, Set, etc.) in c.input, see encodeInterface.
+func (c *MapSetCommand) encode() (initHelpers func(riakRequest requestData), err error) {
+	riakContext, op, initHelpers, err := encodeInterface(c.input)
 	if err != nil {
 		return nil, err
 	}
 
 	// Set context
 	if len(riakContext) > 0 {
-		c.builder.WithContext(riakContext)
+		c.req.context = riakContext
 	}
 
 	// Set the map operation
-	op2 := filterMapOperation(c, op, []string{}, nil)
-
-	c.builder.WithMapOperation(op2)
+	c.req.op = filterMapOperation(c, op, []string{}, nil)
 
-	cmd, err := c.builder.Build()
-	if err != nil {
-		return nil, err
-	}
+	return initHelpers, nil
+}
 
-	err = session.riak.Execute(cmd)
+func (c *MapSetCommand) riakExec(ctx context.Context, session *Session) (*Result, error) {
+	err := session.execute(ctx, c.req)
 	if err != nil {
 		return nil, err
 	}
 
-	updateCmd := cmd.(*riak.UpdateMapCommand)
-
-	if !updateCmd.Success() {
-		return nil, errors.New("Not successful")
-	}
-
 	if c.key != "" {
 		return &Result{
 			Key: c.key,
@@ -193,22 +228,6 @@ func (c *MapSetCommand) riakExec(session *Session) (*Result, error) {
 	}
 
 	return &Result{
-		Key: updateCmd.Response.GeneratedKey,
+		Key: c.req.response.GeneratedKey,
 	}, nil
 }
-
-type setMiddlewarer struct {
-	cmd *MapSetCommand
-}
-
-func (c *setMiddlewarer) Key() string {
-	return c.cmd.key
-}
-
-func (c *setMiddlewarer) Bucket() string {
-	return c.cmd.bucket
-}
-
-func (c *setMiddlewarer) BucketType() string {
-	return c.cmd.bucketType
-}
@@ -0,0 +1,286 @@
+package goriak
+
+import (
+	"encoding"
+	"errors"
+	"reflect"
+
+	riak "github.com/basho/riak-go-client"
+)
+
+// RiakMapMarshaler is implemented by types that can save themselves to a Riak Map.
+//
+// A field with a type that implements RiakMapMarshaler is saved as a nested map named after the field.
+// MarshalRiakMap is called with the operation for the nested map. Only operations that add or update
+// values are supported, removing counters, registers, flags, sets or maps returns an error.
+type RiakMapMarshaler interface {
+	MarshalRiakMap(op *riak.MapOperation) error
+}
+
+// RiakMapUnmarshaler is implemented by types that can read themselves from a Riak Map.
+//
+// UnmarshalRiakMap is called with the nested map that was saved by MarshalRiakMap.
+// It is not called if the map does not exist in Riak.
+type RiakMapUnmarshaler interface {
+	UnmarshalRiakMap(data *riak.Map) error
+}
+
+var (
+	riakMapMarshalerType   = reflect.TypeOf((*RiakMapMarshaler)(nil)).Elem()
+	riakMapUnmarshalerType = reflect.TypeOf((*RiakMapUnmarshaler)(nil)).Elem()
+	binaryMarshalerType    = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	binaryUnmarshalerType  = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+	textMarshalerType      = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType    = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// pointerType returns t if it is a pointer, otherwise a pointer to t.
+// The method set of the pointer includes methods with both value and pointer receivers.
+func pointerType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Ptr {
+		return t
+	}
+
+	return reflect.PtrTo(t)
+}
+
+// isBytesType returns true for types (and pointers to types) with the kind []byte or [N]byte.
+// They are saved as raw bytes, also if they implement encoding.BinaryMarshaler or encoding.TextMarshaler,
+// such as net.IP.
+func isBytesType(t reflect.Type) bool {
+	t = pointerType(t).Elem()
+	return (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() == reflect.Uint8
+}
+
+// isMarshaler returns true if t implements any of the marshaler interfaces
+func isMarshaler(t reflect.Type) bool {
+	return pointerType(t).Implements(riakMapMarshalerType) || isRegisterMarshaler(t)
+}
+
+// isRegisterMarshaler returns true if t implements encoding.BinaryMarshaler or encoding.TextMarshaler,
+// and is not saved as raw bytes, see isBytesType
+func isRegisterMarshaler(t reflect.Type) bool {
+	if isBytesType(t) {
+		return false
+	}
+
+	t = pointerType(t)
+	return t.Implements(binaryMarshalerType) || t.Implements(textMarshalerType)
+}
+
+// isUnmarshaler returns true if t implements any of the unmarshaler interfaces
+func isUnmarshaler(t reflect.Type) bool {
+	return pointerType(t).Implements(riakMapUnmarshalerType) || isRegisterUnmarshaler(t)
+}
+
+// isRegisterUnmarshaler returns true if t implements encoding.BinaryUnmarshaler or encoding.TextUnmarshaler,
+// and is not saved as raw bytes, see isBytesType
+func isRegisterUnmarshaler(t reflect.Type) bool {
+	if isBytesType(t) {
+		return false
+	}
+
+	t = pointerType(t)
+	return t.Implements(binaryUnmarshalerType) || t.Implements(textUnmarshalerType)
+}
+
+// marshalerValue returns a pointer to f as an interface{}, so that methods with pointer receivers can be used.
+// ok is false if f is a nil pointer.
+func marshalerValue(f reflect.Value) (v interface{}, ok bool) {
+	switch {
+	case f.Kind() == reflect.Ptr:
+		if f.IsNil() {
+			return nil, false
+		}
+
+		return f.Interface(), true
+
+	case f.CanAddr():
+		return f.Addr().Interface(), true
+	}
+
+	// Copy f if it is not addressable
+	ptr := reflect.New(f.Type())
+	ptr.Elem().Set(f)
+
+	return ptr.Interface(), true
+}
+
+// marshalRegister converts v to a register with encoding.BinaryMarshaler or encoding.TextMarshaler, in that order
+func marshalRegister(v interface{}) ([]byte, error) {
+	switch m := v.(type) {
+	case encoding.BinaryMarshaler:
+		return m.MarshalBinary()
+	case encoding.TextMarshaler:
+		return m.MarshalText()
+	}
+
+	return nil, errors.New("goriak: not a marshaler: " + reflect.TypeOf(v).String())
+}
+
+// encodeMarshaler saves f with RiakMapMarshaler, encoding.BinaryMarshaler or encoding.TextMarshaler,
+// in that order. done is false if f does not implement any of the interfaces.
+func (e *mapEncoder) encodeMarshaler(op *riakMapOperation, itemKey string, f reflect.Value, path []string) (done bool, err error) {
+	if !f.CanInterface() || !isMarshaler(f.Type()) {
+		return false, nil
+	}
+
+	v, ok := marshalerValue(f)
+
+	// Nil pointers are not saved
+	if !ok {
+		return true, nil
+	}
+
+	switch m := v.(type) {
+	case RiakMapMarshaler:
+		riakOp := &riak.MapOperation{}
+
+		if err := m.MarshalRiakMap(riakOp); err != nil {
+			return true, err
+		}
+
+		if mapOperationRemoves(reflect.ValueOf(riakOp)) {
+			return true, newUnsupportedTypeError(append(path, itemKey), f.Type(), "MarshalRiakMap can not remove values from the map")
+		}
+
+		copyMapOperation(op.Map(itemKey), reflect.ValueOf(riakOp))
+
+	default:
+		register, err := marshalRegister(v)
+
+		if err != nil {
+			return true, err
+		}
+
+		op.SetRegister(itemKey, register)
+	}
+
+	return true, nil
+}
+
+// mapOperationRemoves returns true if a *riak.MapOperation removes any values
+func mapOperationRemoves(op reflect.Value) bool {
+	op = op.Elem()
+
+	for _, name := range []string{"removeCounters", "removeSets", "removeRegisters", "removeFlags", "removeMaps"} {
+		if op.FieldByName(name).Len() > 0 {
+			return true
+		}
+	}
+
+	iter := op.FieldByName("maps").MapRange()
+
+	for iter.Next() {
+		if mapOperationRemoves(iter.Value()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// copyMapOperation copies the operations from a *riak.MapOperation to a *riakMapOperation
+func copyMapOperation(dst *riakMapOperation, src reflect.Value) {
+	src = src.Elem()
+
+	iter := src.FieldByName("incrementCounters").MapRange()
+	for iter.Next() {
+		dst.IncrementCounter(iter.Key().String(), iter.Value().Int())
+	}
+
+	iter = src.FieldByName("addToSets").MapRange()
+	for iter.Next() {
+		for i := 0; i < iter.Value().Len(); i++ {
+			dst.AddToSet(iter.Key().String(), iter.Value().Index(i).Bytes())
+		}
+	}
+
+	iter = src.FieldByName("removeFromSets").MapRange()
+	for iter.Next() {
+		for i := 0; i < iter.Value().Len(); i++ {
+			dst.RemoveFromSet(iter.Key().String(), iter.Value().Index(i).Bytes())
+		}
+	}
+
+	iter = src.FieldByName("registersToSet").MapRange()
+	for iter.Next() {
+		dst.SetRegister(iter.Key().String(), iter.Value().Bytes())
+	}
+
+	iter = src.FieldByName("flagsToSet").MapRange()
+	for iter.Next() {
+		dst.SetFlag(iter.Key().String(), iter.Value().Bool())
+	}
+
+	iter = src.FieldByName("maps").MapRange()
+	for iter.Next() {
+		copyMapOperation(dst.Map(iter.Key().String()), iter.Value())
+	}
+}
+
+// decodeUnmarshaler reads fieldVal with RiakMapUnmarshaler, encoding.BinaryUnmarshaler or encoding.TextUnmarshaler.
+// done is false if the type of fieldVal does not implement any of the interfaces.
+func decodeUnmarshaler(fieldVal reflect.Value, registerName string, data *riak.Map) (done bool, err error) {
+	if !fieldVal.CanSet() || !isUnmarshaler(fieldVal.Type()) {
+		return false, nil
+	}
+
+	if pointerType(fieldVal.Type()).Implements(riakMapUnmarshalerType) {
+		subMap, ok := data.Maps[registerName]
+		if !ok {
+			return true, nil
+		}
+
+		newVal := reflect.New(pointerType(fieldVal.Type()).Elem())
+
+		if err := newVal.Interface().(RiakMapUnmarshaler).UnmarshalRiakMap(subMap); err != nil {
+			return true, err
+		}
+
+		if fieldVal.Kind() == reflect.Ptr {
+			fieldVal.Set(newVal)
+		} else {
+			fieldVal.Set(newVal.Elem())
+		}
+
+		return true, nil
+	}
+
+	if val, ok := data.Registers[registerName]; ok {
+		newVal, err := unmarshalRegister(val, fieldVal.Type())
+
+		if err != nil {
+			return true, err
+		}
+
+		fieldVal.Set(newVal)
+	}
+
+	return true, nil
+}
+
+// unmarshalRegister creates a value of type t from a register with encoding.BinaryUnmarshaler or
+// encoding.TextUnmarshaler, in that order. t must implement one of them.
+func unmarshalRegister(input []byte, t reflect.Type) (reflect.Value, error) {
+	newVal := reflect.New(pointerType(t).Elem())
+
+	var err error
+
+	switch u := newVal.Interface().(type) {
+	case encoding.BinaryUnmarshaler:
+		err = u.UnmarshalBinary(input)
+	case encoding.TextUnmarshaler:
+		err = u.UnmarshalText(input)
+	}
+
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	if t.Kind() == reflect.Ptr {
+		return newVal, nil
+	}
+
+	return newVal.Elem(), nil
+}
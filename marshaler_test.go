@@ -0,0 +1,258 @@
+package goriak
+
+import (
+	"encoding/hex"
+	"errors"
+	"net"
+	"reflect"
+	"strconv"
+	"testing"
+
+	riak "github.com/basho/riak-go-client"
+)
+
+type testUUID [16]byte
+
+func (u testUUID) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(u[:])), nil
+}
+
+func (u *testUUID) UnmarshalText(text []byte) error {
+	_, err := hex.Decode(u[:], text)
+	return err
+}
+
+type testEnum int
+
+const (
+	testEnumUnknown testEnum = iota
+	testEnumActive
+)
+
+func (e testEnum) MarshalText() ([]byte, error) {
+	if e == testEnumActive {
+		return []byte("active"), nil
+	}
+
+	return nil, errors.New("unknown enum value")
+}
+
+func (e *testEnum) UnmarshalText(text []byte) error {
+	if string(text) != "active" {
+		return errors.New("unknown enum value")
+	}
+
+	*e = testEnumActive
+	return nil
+}
+
+type testVersion struct {
+	major, minor uint8
+}
+
+func (v testVersion) MarshalBinary() ([]byte, error) {
+	return []byte{v.major, v.minor}, nil
+}
+
+func (v *testVersion) UnmarshalBinary(data []byte) error {
+	v.major, v.minor = data[0], data[1]
+	return nil
+}
+
+type testDecimal struct {
+	units int64
+	scale int
+}
+
+func (d testDecimal) MarshalRiakMap(op *riak.MapOperation) error {
+	op.SetRegister("units", []byte(strconv.FormatInt(d.units, 10)))
+	op.Map("meta").SetRegister("scale", []byte(strconv.Itoa(d.scale)))
+	return nil
+}
+
+func (d *testDecimal) UnmarshalRiakMap(data *riak.Map) error {
+	units, err := strconv.ParseInt(string(data.Registers["units"]), 10, 64)
+	if err != nil {
+		return err
+	}
+
+	d.units = units
+	d.scale, err = strconv.Atoi(string(data.Maps["meta"].Registers["scale"]))
+	return err
+}
+
+func TestMarshalers(t *testing.T) {
+	type ourTestType struct {
+		ID      testUUID
+		Parent  *testUUID
+		Missing *testUUID
+		Status  testEnum
+		Version testVersion
+		Price   testDecimal
+		Tax     *testDecimal
+		Aliases map[string]testUUID
+	}
+
+	parent := testUUID{15: 1}
+
+	item := ourTestType{
+		ID:      testUUID{0: 0xab, 15: 0xcd},
+		Parent:  &parent,
+		Status:  testEnumActive,
+		Version: testVersion{major: 2, minor: 1},
+		Price:   testDecimal{units: 1999, scale: 2},
+		Tax:     &testDecimal{units: 25, scale: 1},
+		Aliases: map[string]testUUID{"a": {1: 1}},
+	}
+
+	// Not a pointer, methods with pointer receivers are used on a copy
+	result, err := bucket().Set(item).Run(con())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var res ourTestType
+	_, err = bucket().Get(result.Key, &res).Run(con())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !reflect.DeepEqual(item, res) {
+		t.Errorf("values are not equal:\n%+v\n%+v", item, res)
+	}
+
+	// The raw values in Riak, testUUID is a [16]byte and is saved as raw bytes
+	type rawType struct {
+		ID      []byte
+		Status  string
+		Version []byte
+		Price   struct {
+			Units string `goriak:"units"`
+			Meta  struct {
+				Scale string `goriak:"scale"`
+			} `goriak:"meta"`
+		}
+	}
+
+	var raw rawType
+	_, err = bucket().Get(result.Key, &raw).Run(con())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !reflect.DeepEqual(raw.ID, item.ID[:]) || raw.Status != "active" || !reflect.DeepEqual(raw.Version, []byte{2, 1}) {
+		t.Errorf("unexpected raw values: %+v", raw)
+	}
+
+	if raw.Price.Units != "1999" || raw.Price.Meta.Scale != "2" {
+		t.Errorf("unexpected raw map: %+v", raw.Price)
+	}
+}
+
+func TestMarshalerErrors(t *testing.T) {
+	type enumType struct {
+		Status testEnum
+	}
+
+	_, err := bucket().Set(enumType{}).Run(con())
+	if err == nil || err.Error() != "unknown enum value" {
+		t.Error("unexpected error:", err)
+	}
+
+	type stringType struct {
+		Status string
+	}
+
+	result, err := bucket().Set(stringType{Status: "deleted"}).Run(con())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var res enumType
+	_, err = bucket().Get(result.Key, &res).Run(con())
+	if err == nil || err.Error() != "unknown enum value" {
+		t.Error("unexpected error:", err)
+	}
+}
+
+type testRemovingMarshaler struct{}
+
+func (testRemovingMarshaler) MarshalRiakMap(op *riak.MapOperation) error {
+	op.Map("sub").RemoveRegister("a")
+	return nil
+}
+
+func TestRiakMapMarshalerRemove(t *testing.T) {
+	type ourTestType struct {
+		A testRemovingMarshaler
+	}
+
+	_, err := bucket().Set(ourTestType{}).Run(con())
+	if !errors.Is(err, ErrUnsupportedType) {
+		t.Error("unexpected error:", err)
+	}
+}
+
+func TestMarshalerBytesTypes(t *testing.T) {
+	// Written before TextMarshaler was supported, net.IP was saved as raw bytes
+	type oldType struct {
+		IP      []byte
+		Gateway []byte
+		DNS     [][]byte
+	}
+
+	old := oldType{
+		IP:      net.ParseIP("10.0.0.1"),
+		Gateway: net.ParseIP("10.0.0.254").To4(),
+		DNS:     [][]byte{net.ParseIP("8.8.8.8"), net.ParseIP("2001:4860:4860::8888")},
+	}
+
+	result, err := bucket().Set(old).Run(con())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	type ipType struct {
+		IP      net.IP
+		Gateway *net.IP
+		DNS     []net.IP
+	}
+
+	var res ipType
+	_, err = bucket().Get(result.Key, &res).Run(con())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !res.IP.Equal(net.ParseIP("10.0.0.1")) || res.Gateway == nil || !res.Gateway.Equal(net.ParseIP("10.0.0.254")) || len(res.DNS) != 2 {
+		t.Errorf("unexpected values: %+v", res)
+	}
+
+	// New values are saved as raw bytes as well
+	result, err = bucket().Set(res).Run(con())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var raw oldType
+	_, err = bucket().Get(result.Key, &raw).Run(con())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !reflect.DeepEqual(raw.IP, old.IP) || !reflect.DeepEqual(raw.Gateway, old.Gateway) {
+		t.Errorf("unexpected raw values: %+v", raw)
+	}
+
+	if !reflect.DeepEqual(sortedItems(reflect.ValueOf(raw.DNS)), sortedItems(reflect.ValueOf(old.DNS))) {
+		t.Errorf("unexpected raw set: %+v", raw.DNS)
+	}
+}
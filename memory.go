@@ -0,0 +1,751 @@
+package goriak
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	riak "github.com/basho/riak-go-client"
+)
+
+// NewMemorySession returns a Session that keeps all data in memory instead of connecting to Riak.
+// It is intended to be used in tests, all commands works the same way as against Riak.
+//
+// The memory backend follows the defaults of Riak KV 2.0 and later: the bucket type "default"
+// uses last-write-wins, and all other bucket types allows siblings (allow_mult is true).
+// HyperLogLogs are not estimated, the cardinality that is returned is always exact.
+func NewMemorySession() *Session {
+	return &Session{
+		backend: newMemoryBackend(),
+	}
+}
+
+// memoryNVal is the n_val used by the memory backend, the same as the Riak default
+const memoryNVal = 3
+
+// memoryNodeName and memoryServerVersion are reported by the memory backend as the
+// node name and Riak version in ServerInfo, and the address in Health
+const (
+	memoryNodeName      = "memory"
+	memoryServerVersion = "2.2.3"
+)
+
+type memoryKey struct {
+	bucketType string
+	bucket     string
+	key        string
+}
+
+type memorySibling struct {
+	object  *riak.Object
+	version uint64 // The version of the backend when the sibling was written
+}
+
+type memoryMap struct {
+	value   *riak.Map
+	version uint64 // The version of the backend when the map was last updated
+}
+
+// memoryBackend is a backend that keeps all data in memory
+type memoryBackend struct {
+	mu sync.Mutex
+
+	// version is increased on every write, and is used as vclocks and contexts
+	version uint64
+
+	values map[memoryKey][]memorySibling
+	maps   map[memoryKey]*memoryMap
+	hlls   map[memoryKey]map[string]struct{}
+
+	closed bool
+}
+
+func newMemoryBackend() *memoryBackend {
+	return &memoryBackend{
+		values: make(map[memoryKey][]memorySibling),
+		maps:   make(map[memoryKey]*memoryMap),
+		hlls:   make(map[memoryKey]map[string]struct{}),
+	}
+}
+
+func (b *memoryBackend) execute(ctx context.Context, req request) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Use the same validation as riak-go-client, such as that the bucket is set
+	if _, err := req.build(); err != nil {
+		return err
+	}
+
+	switch req := req.(type) {
+	case *fetchValueRequest:
+		return b.fetchValue(req)
+	case *storeValueRequest:
+		return b.storeValue(req)
+	case *deleteValueRequest:
+		return b.deleteValue(req)
+	case *listKeysRequest:
+		return b.listKeys(req)
+	case *secondaryIndexRequest:
+		return b.secondaryIndex(req)
+	case *fetchMapRequest:
+		return b.fetchMap(req)
+	case *updateMapRequest:
+		return b.updateMap(req)
+	case *fetchHllRequest:
+		return b.fetchHll(req)
+	case *updateHllRequest:
+		return b.updateHll(req)
+	case *pingRequest:
+		return nil
+	case *serverInfoRequest:
+		req.response = &riak.GetServerInfoResponse{
+			Node:          memoryNodeName,
+			ServerVersion: memoryServerVersion,
+		}
+		return nil
+	}
+
+	return fmt.Errorf("goriak: %T is not supported by the memory backend", req)
+}
+
+// validate returns the same error as Riak when a quorum is larger than n_val
+func (q quorum) validate() error {
+	for _, v := range []uint32{q.r, q.pr, q.w, q.pw, q.dw} {
+		if v > memoryNVal {
+			return newRiakError(riak.ClientError{
+				Errmsg: riak.ErrClusterNoNodesAvailable,
+				InnerError: riak.RiakError{
+					Errmsg: "{n_val_violation," + strconv.Itoa(memoryNVal) + "}",
+				},
+			}, "")
+		}
+	}
+
+	return nil
+}
+
+func encodeMemoryVersion(version uint64) []byte {
+	res := make([]byte, 8)
+	binary.BigEndian.PutUint64(res, version)
+	return res
+}
+
+func decodeMemoryVersion(in []byte) uint64 {
+	if len(in) != 8 {
+		return 0
+	}
+
+	return binary.BigEndian.Uint64(in)
+}
+
+// executeOnNode runs req on the only node of the memory backend
+func (b *memoryBackend) executeOnNode(ctx context.Context, address string, req request) error {
+	if address != memoryNodeName {
+		return errors.New("goriak: unknown node: " + address)
+	}
+
+	return b.execute(ctx, req)
+}
+
+// addNode is not supported by the memory backend, which always has a single node
+func (b *memoryBackend) addNode(address string) error {
+	return errors.New("goriak: nodes can not be added to the memory backend")
+}
+
+// removeNode is not supported by the memory backend, which always has a single node
+func (b *memoryBackend) removeNode(address string) error {
+	return errors.New("goriak: nodes can not be removed from the memory backend")
+}
+
+// health reports a single node, that is running until the backend is closed
+func (b *memoryBackend) health() []NodeHealth {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state := NodeRunning
+	if b.closed {
+		state = NodeShutdown
+	}
+
+	return []NodeHealth{{Address: memoryNodeName, State: state}}
+}
+
+// close drops all stored data
+func (b *memoryBackend) close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	b.values = nil
+	b.maps = nil
+	b.hlls = nil
+
+	return nil
+}
+
+// generateKey returns a new random key that is not used in the bucket.
+// Must be called with b.mu held.
+func (b *memoryBackend) generateKey(bucketType, bucket string) string {
+	for {
+		buf := make([]byte, 14)
+		rand.Read(buf)
+		k := memoryKey{bucketType: bucketType, bucket: bucket, key: hex.EncodeToString(buf)}
+
+		_, inValues := b.values[k]
+		_, inMaps := b.maps[k]
+		_, inHlls := b.hlls[k]
+
+		if !inValues && !inMaps && !inHlls {
+			return k.key
+		}
+	}
+}
+
+func (b *memoryBackend) fetchValue(req *fetchValueRequest) error {
+	if err := req.quorum.validate(); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	siblings := b.values[memoryKey{bucketType: req.bucketType, bucket: req.bucket, key: req.key}]
+
+	if len(siblings) == 0 {
+		req.response = &riak.FetchValueResponse{IsNotFound: true}
+		return nil
+	}
+
+	// The vclock covers all current siblings
+	var version uint64
+	for _, s := range siblings {
+		if s.version > version {
+			version = s.version
+		}
+	}
+
+	vclock := encodeMemoryVersion(version)
+
+	values := make([]*riak.Object, len(siblings))
+	for i, s := range siblings {
+		values[i] = copyMemoryObject(s.object)
+		values[i].VClock = vclock
+	}
+
+	req.response = &riak.FetchValueResponse{
+		VClock: vclock,
+		Values: values,
+	}
+
+	return nil
+}
+
+func (b *memoryBackend) storeValue(req *storeValueRequest) error {
+	if err := req.quorum.validate(); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	response := &riak.StoreValueResponse{}
+
+	key := req.key
+	if key == "" {
+		key = b.generateKey(req.bucketType, req.bucket)
+		response.GeneratedKey = key
+	}
+
+	k := memoryKey{bucketType: req.bucketType, bucket: req.bucket, key: key}
+
+	b.version++
+
+	object := copyMemoryObject(req.object)
+	object.BucketType = req.bucketType
+	object.Bucket = req.bucket
+	object.Key = key
+	object.LastModified = time.Now()
+
+	var siblings []memorySibling
+
+	// Keep the siblings that the writer has not seen
+	if req.bucketType != "default" {
+		seen := decodeMemoryVersion(req.vclock)
+
+		for _, s := range b.values[k] {
+			if s.version > seen {
+				siblings = append(siblings, s)
+			}
+		}
+	}
+
+	b.values[k] = append(siblings, memorySibling{
+		object:  object,
+		version: b.version,
+	})
+
+	response.VClock = encodeMemoryVersion(b.version)
+	req.response = response
+
+	return nil
+}
+
+func (b *memoryBackend) deleteValue(req *deleteValueRequest) error {
+	if err := req.quorum.validate(); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	k := memoryKey{bucketType: req.bucketType, bucket: req.bucket, key: req.key}
+
+	delete(b.values, k)
+	delete(b.maps, k)
+	delete(b.hlls, k)
+
+	return nil
+}
+
+func (b *memoryBackend) listKeys(req *listKeysRequest) error {
+	b.mu.Lock()
+
+	var keys []string
+	seen := make(map[string]struct{})
+
+	add := func(k memoryKey) {
+		if k.bucketType != req.bucketType || k.bucket != req.bucket {
+			return
+		}
+
+		if _, ok := seen[k.key]; !ok {
+			seen[k.key] = struct{}{}
+			keys = append(keys, k.key)
+		}
+	}
+
+	for k := range b.values {
+		add(k)
+	}
+
+	for k := range b.maps {
+		add(k)
+	}
+
+	for k := range b.hlls {
+		add(k)
+	}
+
+	// The callback is executed without the lock held, so that it can execute new commands
+	b.mu.Unlock()
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	sort.Strings(keys)
+
+	return req.callback(keys)
+}
+
+type memoryIndexEntry struct {
+	term string
+	key  string
+}
+
+func (b *memoryBackend) secondaryIndex(req *secondaryIndexRequest) error {
+	isInt := strings.HasSuffix(req.indexName, "_int")
+
+	// less sorts the entries in the same order as Riak, by term and then by key
+	less := func(a, b memoryIndexEntry) bool {
+		if a.term != b.term {
+			if isInt {
+				ai, _ := strconv.ParseInt(a.term, 10, 64)
+				bi, _ := strconv.ParseInt(b.term, 10, 64)
+				return ai < bi
+			}
+
+			return a.term < b.term
+		}
+
+		return a.key < b.key
+	}
+
+	matches := func(term string) bool {
+		if !req.isRange {
+			return term == req.indexKey
+		}
+
+		if isInt {
+			val, err := strconv.ParseInt(term, 10, 64)
+			if err != nil {
+				return false
+			}
+
+			min, _ := strconv.ParseInt(req.rangeMin, 10, 64)
+			max, _ := strconv.ParseInt(req.rangeMax, 10, 64)
+			return val >= min && val <= max
+		}
+
+		return term >= req.rangeMin && term <= req.rangeMax
+	}
+
+	b.mu.Lock()
+
+	var entries []memoryIndexEntry
+	seen := make(map[memoryIndexEntry]struct{})
+
+	for k, siblings := range b.values {
+		if k.bucketType != req.bucketType || k.bucket != req.bucket {
+			continue
+		}
+
+		for _, s := range siblings {
+			var terms []string
+
+			switch req.indexName {
+			case "$bucket":
+				terms = []string{k.bucket}
+			case "$key":
+				terms = []string{k.key}
+			default:
+				terms = s.object.Indexes[req.indexName]
+			}
+
+			for _, term := range terms {
+				entry := memoryIndexEntry{term: term, key: k.key}
+
+				if _, ok := seen[entry]; ok || !matches(term) {
+					continue
+				}
+
+				seen[entry] = struct{}{}
+				entries = append(entries, entry)
+			}
+		}
+	}
+
+	// The callback is executed without the lock held, so that it can execute new commands
+	b.mu.Unlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		return less(entries[i], entries[j])
+	})
+
+	// Skip the entries that was returned in a previous page
+	if len(req.continuation) > 0 {
+		parts := strings.SplitN(string(req.continuation), "\x00", 2)
+
+		if len(parts) == 2 {
+			last := memoryIndexEntry{term: parts[0], key: parts[1]}
+
+			for len(entries) > 0 && !less(last, entries[0]) {
+				entries = entries[1:]
+			}
+		}
+	}
+
+	response := &riak.SecondaryIndexQueryResponse{}
+
+	if req.maxResults > 0 && uint32(len(entries)) > req.maxResults {
+		entries = entries[:req.maxResults]
+		last := entries[len(entries)-1]
+		response.Continuation = []byte(last.term + "\x00" + last.key)
+	}
+
+	results := make([]*riak.SecondaryIndexQueryResult, len(entries))
+	for i, entry := range entries {
+		results[i] = &riak.SecondaryIndexQueryResult{
+			ObjectKey: []byte(entry.key),
+		}
+	}
+
+	if len(results) > 0 {
+		if err := req.callback(results); err != nil {
+			return err
+		}
+	}
+
+	// Riak finishes all streams with an empty response
+	if err := req.callback([]*riak.SecondaryIndexQueryResult{}); err != nil {
+		return err
+	}
+
+	req.response = response
+	return nil
+}
+
+func (b *memoryBackend) fetchMap(req *fetchMapRequest) error {
+	if err := req.quorum.validate(); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	m, ok := b.maps[memoryKey{bucketType: req.bucketType, bucket: req.bucket, key: req.key}]
+	if !ok {
+		req.response = &riak.FetchMapResponse{IsNotFound: true}
+		return nil
+	}
+
+	req.response = &riak.FetchMapResponse{
+		Context: encodeMemoryVersion(m.version),
+		Map:     copyMemoryMap(m.value),
+	}
+
+	return nil
+}
+
+func (b *memoryBackend) updateMap(req *updateMapRequest) error {
+	if err := req.quorum.validate(); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	response := &riak.UpdateMapResponse{}
+
+	key := req.key
+	if key == "" {
+		key = b.generateKey(req.bucketType, req.bucket)
+		response.GeneratedKey = key
+	}
+
+	k := memoryKey{bucketType: req.bucketType, bucket: req.bucket, key: key}
+
+	m, ok := b.maps[k]
+	if !ok {
+		m = &memoryMap{value: newMemoryMap()}
+		b.maps[k] = m
+	}
+
+	applyMemoryMapOperation(m.value, reflect.ValueOf(req.op).Elem())
+
+	b.version++
+	m.version = b.version
+
+	if req.returnBody {
+		response.Context = encodeMemoryVersion(m.version)
+		response.Map = copyMemoryMap(m.value)
+	}
+
+	req.response = response
+	return nil
+}
+
+func (b *memoryBackend) fetchHll(req *fetchHllRequest) error {
+	if err := req.quorum.validate(); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	hll, ok := b.hlls[memoryKey{bucketType: req.bucketType, bucket: req.bucket, key: req.key}]
+	if !ok {
+		req.response = &riak.FetchHllResponse{IsNotFound: true}
+		return nil
+	}
+
+	req.response = &riak.FetchHllResponse{
+		Cardinality: uint64(len(hll)),
+	}
+
+	return nil
+}
+
+func (b *memoryBackend) updateHll(req *updateHllRequest) error {
+	if err := req.quorum.validate(); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	response := &riak.UpdateHllResponse{}
+
+	key := req.key
+	if key == "" {
+		key = b.generateKey(req.bucketType, req.bucket)
+		response.GeneratedKey = key
+	}
+
+	k := memoryKey{bucketType: req.bucketType, bucket: req.bucket, key: key}
+
+	hll, ok := b.hlls[k]
+	if !ok {
+		hll = make(map[string]struct{})
+		b.hlls[k] = hll
+	}
+
+	for _, add := range req.additions {
+		hll[string(add)] = struct{}{}
+	}
+
+	if req.returnBody {
+		response.Cardinality = uint64(len(hll))
+	}
+
+	req.response = response
+	return nil
+}
+
+func copyMemoryObject(in *riak.Object) *riak.Object {
+	out := *in
+
+	out.Value = append([]byte{}, in.Value...)
+
+	if in.Indexes != nil {
+		out.Indexes = make(map[string][]string, len(in.Indexes))
+		for k, v := range in.Indexes {
+			out.Indexes[k] = append([]string{}, v...)
+		}
+	}
+
+	return &out
+}
+
+func newMemoryMap() *riak.Map {
+	return &riak.Map{
+		Counters:  make(map[string]int64),
+		Sets:      make(map[string][][]byte),
+		Registers: make(map[string][]byte),
+		Flags:     make(map[string]bool),
+		Maps:      make(map[string]*riak.Map),
+	}
+}
+
+func copyMemoryMap(in *riak.Map) *riak.Map {
+	out := newMemoryMap()
+
+	for k, v := range in.Counters {
+		out.Counters[k] = v
+	}
+
+	for k, v := range in.Sets {
+		set := make([][]byte, len(v))
+		for i, item := range v {
+			set[i] = append([]byte{}, item...)
+		}
+		out.Sets[k] = set
+	}
+
+	for k, v := range in.Registers {
+		out.Registers[k] = append([]byte{}, v...)
+	}
+
+	for k, v := range in.Flags {
+		out.Flags[k] = v
+	}
+
+	for k, v := range in.Maps {
+		out.Maps[k] = copyMemoryMap(v)
+	}
+
+	return out
+}
+
+// applyMemoryMapOperation applies the riak.MapOperation op to m.
+// The fields in riak.MapOperation are not exported, and are read with reflection instead.
+func applyMemoryMapOperation(m *riak.Map, op reflect.Value) {
+	removed := func(field string, fn func(key string)) {
+		for _, key := range op.FieldByName(field).MapKeys() {
+			fn(key.String())
+		}
+	}
+
+	// Removals are performed before the updates
+	removed("removeCounters", func(key string) { delete(m.Counters, key) })
+	removed("removeSets", func(key string) { delete(m.Sets, key) })
+	removed("removeRegisters", func(key string) { delete(m.Registers, key) })
+	removed("removeFlags", func(key string) { delete(m.Flags, key) })
+	removed("removeMaps", func(key string) { delete(m.Maps, key) })
+
+	iter := op.FieldByName("incrementCounters").MapRange()
+	for iter.Next() {
+		m.Counters[iter.Key().String()] += iter.Value().Int()
+	}
+
+	iter = op.FieldByName("removeFromSets").MapRange()
+	for iter.Next() {
+		key := iter.Key().String()
+
+		for i := 0; i < iter.Value().Len(); i++ {
+			remove := iter.Value().Index(i).Bytes()
+
+			set := m.Sets[key]
+			for si, item := range set {
+				if bytes.Equal(item, remove) {
+					m.Sets[key] = append(set[:si:si], set[si+1:]...)
+					break
+				}
+			}
+		}
+	}
+
+	iter = op.FieldByName("addToSets").MapRange()
+	for iter.Next() {
+		key := iter.Key().String()
+
+		set, ok := m.Sets[key]
+		if !ok {
+			set = [][]byte{}
+		}
+
+		for i := 0; i < iter.Value().Len(); i++ {
+			add := append([]byte{}, iter.Value().Index(i).Bytes()...)
+
+			// Riak returns the items in a set sorted
+			pos := sort.Search(len(set), func(si int) bool {
+				return bytes.Compare(set[si], add) >= 0
+			})
+
+			if pos < len(set) && bytes.Equal(set[pos], add) {
+				continue
+			}
+
+			set = append(set, nil)
+			copy(set[pos+1:], set[pos:])
+			set[pos] = add
+		}
+
+		m.Sets[key] = set
+	}
+
+	iter = op.FieldByName("registersToSet").MapRange()
+	for iter.Next() {
+		m.Registers[iter.Key().String()] = append([]byte{}, iter.Value().Bytes()...)
+	}
+
+	iter = op.FieldByName("flagsToSet").MapRange()
+	for iter.Next() {
+		m.Flags[iter.Key().String()] = iter.Value().Bool()
+	}
+
+	iter = op.FieldByName("maps").MapRange()
+	for iter.Next() {
+		key := iter.Key().String()
+
+		subMap, ok := m.Maps[key]
+		if !ok {
+			subMap = newMemoryMap()
+			m.Maps[key] = subMap
+		}
+
+		applyMemoryMapOperation(subMap, iter.Value().Elem())
+	}
+}
@@ -0,0 +1,304 @@
+package goriak
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestMemorySessionRaw(t *testing.T) {
+	session := NewMemorySession()
+
+	res, err := Bucket("raw", "default").SetRaw([]byte("hello")).Run(session)
+	if err != nil {
+		t.Error(err)
+	}
+
+	var out []byte
+	_, err = Bucket("raw", "default").GetRaw(res.Key, &out).Run(session)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if string(out) != "hello" {
+		t.Error("unexpected value:", string(out))
+	}
+
+	_, err = Bucket("raw", "default").Delete(res.Key).Run(session)
+	if err != nil {
+		t.Error(err)
+	}
+
+	getRes, err := Bucket("raw", "default").GetRaw(res.Key, &out).Run(session)
+	if err == nil {
+		t.Error("no error")
+	}
+
+	if !getRes.NotFound {
+		t.Error("not marked as not found")
+	}
+}
+
+func TestMemorySessionSiblings(t *testing.T) {
+	session := NewMemorySession()
+
+	Bucket("sibs", "tests").SetRaw([]byte("a")).Key("key").Run(session)
+	Bucket("sibs", "tests").SetRaw([]byte("b")).Key("key").Run(session)
+
+	siblings := 0
+
+	resolver := func(objs []ConflictObject) ResolvedConflict {
+		siblings = len(objs)
+		return objs[1].GetResolved()
+	}
+
+	var out []byte
+	_, err := Bucket("sibs", "tests").GetRaw("key", &out).ConflictResolver(resolver).Run(session)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if siblings != 2 {
+		t.Error("unexpected sibling count:", siblings)
+	}
+
+	// The resolved value has been written back
+	siblings = 0
+	res, err := Bucket("sibs", "tests").GetRaw("key", &out).ConflictResolver(resolver).Run(session)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if siblings != 0 || string(out) != "b" {
+		t.Error("unexpected resolution:", siblings, string(out))
+	}
+
+	// Writes with a vclock does not create siblings
+	Bucket("sibs", "tests").SetRaw([]byte("c")).Key("key").WithContext(res.Context).Run(session)
+
+	_, err = Bucket("sibs", "tests").GetRaw("key", &out).Run(session)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if string(out) != "c" {
+		t.Error("unexpected value:", string(out))
+	}
+
+	// Bucket type default uses last-write-wins
+	Bucket("sibs", "default").SetRaw([]byte("a")).Key("key").Run(session)
+	Bucket("sibs", "default").SetRaw([]byte("b")).Key("key").Run(session)
+
+	_, err = Bucket("sibs", "default").GetRaw("key", &out).Run(session)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if string(out) != "b" {
+		t.Error("unexpected value:", string(out))
+	}
+}
+
+func TestMemorySessionMap(t *testing.T) {
+	session := NewMemorySession()
+
+	type ourTestType struct {
+		Name    string
+		Tags    []string
+		Views   *Counter
+		Aliases *Set
+		Sub     struct {
+			Enabled bool
+		}
+	}
+
+	val := ourTestType{
+		Name: "Foo",
+		Tags: []string{"b", "a"},
+	}
+	val.Sub.Enabled = true
+
+	_, err := Bucket("maps", "maps").Set(&val).Key("key").Run(session)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = val.Views.Increase(3).Exec(session)
+	if err != nil {
+		t.Error(err)
+	}
+
+	var res ourTestType
+	_, err = Bucket("maps", "maps").Get("key", &res).Run(session)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if res.Name != "Foo" || !res.Sub.Enabled || res.Views.Value() != 3 {
+		t.Errorf("unexpected value: %+v", res)
+	}
+
+	if !reflect.DeepEqual(res.Tags, []string{"a", "b"}) {
+		t.Error("unexpected tags:", res.Tags)
+	}
+
+	err = res.Aliases.AddString("x").AddString("y").Exec(session)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = res.Aliases.RemoveString("x").Exec(session)
+	if err != nil {
+		t.Error(err)
+	}
+
+	var res2 ourTestType
+	_, err = Bucket("maps", "maps").Get("key", &res2).Run(session)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !reflect.DeepEqual(res2.Aliases.Strings(), []string{"y"}) {
+		t.Error("unexpected aliases:", res2.Aliases.Strings())
+	}
+}
+
+func TestMemorySessionHyperLogLog(t *testing.T) {
+	session := NewMemorySession()
+
+	res, err := Bucket("hll", "hlls").
+		UpdateHyperLogLog().
+		AddMultiple([]byte("a"), []byte("b"), []byte("a")).
+		ReturnBody(true).
+		Run(session)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res.Cardinality != 2 {
+		t.Error("unexpected cardinality:", res.Cardinality)
+	}
+
+	res2, err := Bucket("hll", "hlls").GetHyperLogLog(res.Key).Run(session)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if res2.Cardinality != 2 || res2.NotFound {
+		t.Error("unexpected result:", res2)
+	}
+
+	res3, err := Bucket("hll", "hlls").GetHyperLogLog("unknown").Run(session)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !res3.NotFound {
+		t.Error("not marked as not found")
+	}
+}
+
+func TestMemorySessionSecondaryIndexes(t *testing.T) {
+	session := NewMemorySession()
+
+	for i, key := range []string{"a", "b", "c", "d", "e"} {
+		_, err := Bucket("json", "default").
+			SetJSON(key).
+			Key(key).
+			AddToIndex("letter_bin", key).
+			AddToIndex("number_int", []string{"9", "10", "11", "100", "1000"}[i]).
+			Run(session)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	var keys []string
+	cb := func(r SecondaryIndexQueryResult) {
+		if !r.IsComplete {
+			keys = append(keys, r.Key)
+		}
+	}
+
+	var cont []byte
+	fetches := 0
+
+	for {
+		res, err := Bucket("json", "default").
+			KeysInIndexRange("letter_bin", "b", "e", cb).
+			Limit(2).
+			IndexContinuation(cont).
+			Run(session)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		fetches++
+
+		if len(res.Continuation) == 0 {
+			break
+		}
+
+		cont = res.Continuation
+	}
+
+	if fetches != 2 {
+		t.Error("unexpected fetches:", fetches)
+	}
+
+	if !reflect.DeepEqual(keys, []string{"b", "c", "d", "e"}) {
+		t.Error("unexpected keys:", keys)
+	}
+
+	// Integer indexes are compared as numbers
+	keys = nil
+	Bucket("json", "default").KeysInIndexRange("number_int", "10", "100", cb).Run(session)
+
+	if !reflect.DeepEqual(keys, []string{"b", "c", "d"}) {
+		t.Error("unexpected keys:", keys)
+	}
+
+	keys = nil
+	Bucket("json", "default").KeysInIndex("letter_bin", "c", cb).Run(session)
+
+	if !reflect.DeepEqual(keys, []string{"c"}) {
+		t.Error("unexpected keys:", keys)
+	}
+}
+
+func TestMemorySessionAllKeys(t *testing.T) {
+	session := NewMemorySession()
+
+	Bucket("keys", "default").SetRaw([]byte{1}).Key("a").Run(session)
+	Bucket("keys", "maps").Set(struct{ A string }{"a"}).Key("b").Run(session)
+	Bucket("keys", "default").SetRaw([]byte{1}).Key("c").Run(session)
+	Bucket("other", "default").SetRaw([]byte{1}).Key("d").Run(session)
+
+	var keys []string
+
+	_, err := Bucket("keys", "default").AllKeys(func(res []string) error {
+		keys = append(keys, res...)
+		return nil
+	}).Run(session)
+	if err != nil {
+		t.Error(err)
+	}
+
+	sort.Strings(keys)
+
+	if !reflect.DeepEqual(keys, []string{"a", "c"}) {
+		t.Error("unexpected keys:", keys)
+	}
+}
+
+func TestMemorySessionQuorum(t *testing.T) {
+	_, err := Bucket("raw", "default").SetRaw([]byte{1}).WithW(4).Run(NewMemorySession())
+
+	expectedError := "ClientError|[Cluster] all retries exhausted and/or no nodes available to execute command|InnerError|RiakError|0|{n_val_violation,3}"
+
+	if err == nil || err.Error() != expectedError {
+		t.Error("unexpected error:", err)
+	}
+}
@@ -1,41 +1,258 @@
 package goriak
 
+import (
+	"context"
+	"reflect"
+)
+
 type RunMiddlewarer interface {
 	Key() string
 	Bucket() string
 	BucketType() string
+
+	// Context returns the context that the command is executed with.
+	// Is context.Background() when the command is executed with Run().
+	Context() context.Context
+
+	// Operation returns the type of the command
+	Operation() Operation
+
+	// Quorum returns the quorum values set on the command.
+	// Values that are not set are 0, and the defaults of the bucket type are used.
+	Quorum() Quorum
+
+	// Size returns the approximate number of bytes written by the command. Is 0 for reads.
+	Size() int
+
+	// Value returns the value stored by SetRaw and SetJSON. Is nil for all other commands.
+	Value() []byte
+
+	// Index returns the query of KeysInIndex and KeysInIndexRange.
+	// Index().Name is empty for all other commands.
+	Index() IndexQuery
+
+	// Idempotent returns false if executing the command more than once has a different result than executing it
+	// once, such as commands that increment counters, add to a HyperLogLog, or save a value without a key.
+	Idempotent() bool
+
+	// ConflictWriteBack returns true for the SetRaw command that saves the value chosen by a conflict resolver
+	// in GetRaw or GetJSON.
+	ConflictWriteBack() bool
 }
 
 type RunMiddleware func(cmd RunMiddlewarer, next func() (*Result, error)) (*Result, error)
 
-type setRawMiddlewarer struct {
-	cmd *SetRawCommand
+// Use adds middleware that wraps every command executed with the session, including Exec() on the
+// Counter, Set, Flag and Register helpers.
+//
+// Session middleware runs before the middleware registered on the command with RegisterRunMiddleware.
+// Middleware is executed in the order that it was added, the first middleware added with Use is the outermost,
+// and the last middleware registered with RegisterRunMiddleware is the closest to the request to Riak.
+func (c *Session) Use(middleware ...RunMiddleware) *Session {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Copy on write, so that commands that are already running are not affected
+	list := make([]RunMiddleware, 0, len(c.middleware)+len(middleware))
+	list = append(list, c.middleware...)
+	c.middleware = append(list, middleware...)
+
+	return c
+}
+
+// sessionMiddleware returns the middleware added with Use
+func (c *Session) sessionMiddleware() []RunMiddleware {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.middleware
+}
+
+// Operation is the type of a command, as seen by middleware
+type Operation string
+
+const (
+	OperationGet               Operation = "get"                 // Get
+	OperationSet               Operation = "set"                 // Set
+	OperationGetRaw            Operation = "get_raw"             // GetRaw
+	OperationSetRaw            Operation = "set_raw"             // SetRaw
+	OperationGetJSON           Operation = "get_json"            // GetJSON
+	OperationSetJSON           Operation = "set_json"            // SetJSON
+	OperationDelete            Operation = "delete"              // Delete
+	OperationAllKeys           Operation = "all_keys"            // AllKeys
+	OperationKeysInIndex       Operation = "keys_in_index"       // KeysInIndex
+	OperationKeysInIndexRange  Operation = "keys_in_index_range" // KeysInIndexRange
+	OperationMapOperation      Operation = "map_operation"       // MapOperation, and Exec() on Counter, Set, Flag and Register
+	OperationGetHyperLogLog    Operation = "get_hyperloglog"     // GetHyperLogLog
+	OperationUpdateHyperLogLog Operation = "update_hyperloglog"  // UpdateHyperLogLog
+)
+
+// IsWrite returns true if the operation modifies data in Riak
+func (o Operation) IsWrite() bool {
+	switch o {
+	case OperationSet, OperationSetRaw, OperationSetJSON, OperationDelete, OperationMapOperation, OperationUpdateHyperLogLog:
+		return true
+	}
+
+	return false
+}
+
+// Quorum is the R, PR, W, PW and DW values of a command
+type Quorum struct {
+	R  uint32
+	PR uint32
+	W  uint32
+	PW uint32
+	DW uint32
+}
+
+// IndexQuery is a secondary index query. Value is used in exact match queries (KeysInIndex),
+// and Min and Max in range queries (KeysInIndexRange).
+type IndexQuery struct {
+	Name    string
+	Value   string
+	IsRange bool
+	Min     string
+	Max     string
+}
+
+// commandMiddlewarer is the RunMiddlewarer used by all commands
+type commandMiddlewarer struct {
+	key        string
+	bucket     string
+	bucketType string
+	ctx        context.Context
+
+	operation Operation
+	quorum    quorum
+	size      int
+	value     []byte
+	index     IndexQuery
+
+	nonIdempotent     bool
+	conflictWriteBack bool
 }
 
-func (c setRawMiddlewarer) Key() string {
-	return c.cmd.key
+func (c *commandMiddlewarer) Key() string {
+	return c.key
 }
 
-func (c setRawMiddlewarer) Bucket() string {
-	return c.cmd.c.bucket
+func (c *commandMiddlewarer) Bucket() string {
+	return c.bucket
 }
 
-func (c setRawMiddlewarer) BucketType() string {
-	return c.cmd.c.bucketType
+func (c *commandMiddlewarer) BucketType() string {
+	return c.bucketType
 }
 
-type getRawMiddlewarer struct {
-	cmd *GetRawCommand
+func (c *commandMiddlewarer) Context() context.Context {
+	return c.ctx
 }
 
-func (c getRawMiddlewarer) Key() string {
-	return c.cmd.key
+func (c *commandMiddlewarer) Operation() Operation {
+	return c.operation
 }
 
-func (c getRawMiddlewarer) Bucket() string {
-	return c.cmd.bucket
+func (c *commandMiddlewarer) Quorum() Quorum {
+	return Quorum{
+		R:  c.quorum.r,
+		PR: c.quorum.pr,
+		W:  c.quorum.w,
+		PW: c.quorum.pw,
+		DW: c.quorum.dw,
+	}
 }
 
-func (c getRawMiddlewarer) BucketType() string {
-	return c.cmd.bucketType
+func (c *commandMiddlewarer) Size() int {
+	return c.size
+}
+
+func (c *commandMiddlewarer) Value() []byte {
+	return c.value
+}
+
+func (c *commandMiddlewarer) Index() IndexQuery {
+	return c.index
+}
+
+func (c *commandMiddlewarer) Idempotent() bool {
+	return !c.nonIdempotent
+}
+
+func (c *commandMiddlewarer) ConflictWriteBack() bool {
+	return c.conflictWriteBack
+}
+
+// mapOperationSize returns the approximate number of bytes written by a *riak.MapOperation or *riakMapOperation.
+// The keys and values of all operations are counted, counters as 8 bytes and flags as 1 byte.
+func mapOperationSize(op reflect.Value) int {
+	if op.IsNil() {
+		return 0
+	}
+
+	op = op.Elem()
+	size := 0
+
+	// All fields are maps from the name of the field in the Riak Map to the operation
+	for i := 0; i < op.NumField(); i++ {
+		if op.Field(i).Kind() != reflect.Map {
+			continue
+		}
+
+		iter := op.Field(i).MapRange()
+
+		for iter.Next() {
+			size += len(iter.Key().String())
+
+			val := iter.Value()
+
+			switch val.Kind() {
+			case reflect.Int64:
+				size += 8
+			case reflect.Bool:
+				size++
+			case reflect.Ptr:
+				size += mapOperationSize(val)
+			case reflect.Slice:
+				// []byte for registers, and [][]byte for sets
+				if val.Type().Elem().Kind() == reflect.Uint8 {
+					size += val.Len()
+					continue
+				}
+
+				for j := 0; j < val.Len(); j++ {
+					size += val.Index(j).Len()
+				}
+			}
+		}
+	}
+
+	return size
+}
+
+// mapOperationIncrements returns true if a *riak.MapOperation or *riakMapOperation increments a counter
+func mapOperationIncrements(op reflect.Value) bool {
+	if op.IsNil() {
+		return false
+	}
+
+	op = op.Elem()
+
+	iter := op.FieldByName("incrementCounters").MapRange()
+
+	for iter.Next() {
+		if iter.Value().Int() != 0 {
+			return true
+		}
+	}
+
+	iter = op.FieldByName("maps").MapRange()
+
+	for iter.Next() {
+		if mapOperationIncrements(iter.Value()) {
+			return true
+		}
+	}
+
+	return false
 }
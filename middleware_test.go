@@ -2,6 +2,7 @@ package goriak
 
 import (
 	"errors"
+	"reflect"
 	"testing"
 )
 
@@ -313,3 +314,512 @@ func TestMiddlewareSet(t *testing.T) {
 		t.Error("middleware did not execute")
 	}
 }
+
+func TestMiddlewareAllCommands(t *testing.T) {
+	var ops []string
+
+	m := func(cmd RunMiddlewarer, next func() (*Result, error)) (*Result, error) {
+		res, err := next()
+		ops = append(ops, cmd.BucketType()+"/"+cmd.Bucket()+"/"+cmd.Key())
+		return res, err
+	}
+
+	key := randomKey()
+
+	_, err := Bucket("middleware", "default").RegisterRunMiddleware(m).Delete(key).Run(con())
+	if err != nil {
+		t.Error(err)
+	}
+
+	_, err = Bucket("middleware", "default").RegisterRunMiddleware(m).AllKeys(func([]string) error { return nil }).Run(con())
+	if err != nil {
+		t.Error(err)
+	}
+
+	_, err = Bucket("middleware", "default").RegisterRunMiddleware(m).KeysInIndex("idx_bin", "foo", func(SecondaryIndexQueryResult) {}).Run(con())
+	if err != nil {
+		t.Error(err)
+	}
+
+	_, err = Bucket("middleware", "default").RegisterRunMiddleware(m).KeysInIndexRange("idx_bin", "a", "z", func(SecondaryIndexQueryResult) {}).Run(con())
+	if err != nil {
+		t.Error(err)
+	}
+
+	op := NewMapOperation()
+	op.SetRegister("name", []byte("foo"))
+
+	_, err = Bucket("middleware", "maps").RegisterRunMiddleware(m).MapOperation(op).Key(key).Run(con())
+	if err != nil {
+		t.Error(err)
+	}
+
+	_, err = Bucket("middleware", "hlls").RegisterRunMiddleware(m).UpdateHyperLogLog().Key(key).Add([]byte("a")).Run(con())
+	if err != nil {
+		t.Error(err)
+	}
+
+	_, err = Bucket("middleware", "hlls").RegisterRunMiddleware(m).GetHyperLogLog(key).Run(con())
+	if err != nil {
+		t.Error(err)
+	}
+
+	expected := []string{
+		"default/middleware/" + key,
+		"default/middleware/",
+		"default/middleware/",
+		"default/middleware/",
+		"maps/middleware/" + key,
+		"hlls/middleware/" + key,
+		"hlls/middleware/" + key,
+	}
+
+	if !reflect.DeepEqual(ops, expected) {
+		t.Error("unexpected middleware calls:", ops)
+	}
+}
+
+func TestMiddlewareHelperExec(t *testing.T) {
+	type testType struct {
+		Counter  *Counter
+		Set      *Set
+		Flag     *Flag
+		Register *Register
+	}
+
+	calls := 0
+
+	m := func(cmd RunMiddlewarer, next func() (*Result, error)) (*Result, error) {
+		calls++
+
+		if cmd.Bucket() != "middleware" || cmd.BucketType() != "maps" || cmd.Key() == "" {
+			t.Error("unexpected command:", cmd.BucketType(), cmd.Bucket(), cmd.Key())
+		}
+
+		return next()
+	}
+
+	key := randomKey()
+
+	var val testType
+
+	_, err := Bucket("middleware", "maps").RegisterRunMiddleware(m).Get(key, &val).Run(con())
+	if err != ErrNotFound {
+		t.Error(err)
+	}
+
+	val = testType{
+		Counter:  NewCounter(),
+		Set:      NewSet(),
+		Flag:     NewFlag(),
+		Register: NewRegister(),
+	}
+
+	_, err = Bucket("middleware", "maps").RegisterRunMiddleware(m).Set(val).Key(key).Run(con())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var res testType
+
+	_, err = Bucket("middleware", "maps").RegisterRunMiddleware(m).Get(key, &res).Run(con())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	calls = 0
+
+	if err := res.Counter.Increase(1).Exec(con()); err != nil {
+		t.Error(err)
+	}
+
+	if err := res.Set.AddString("a").Exec(con()); err != nil {
+		t.Error(err)
+	}
+
+	if err := res.Flag.Set(true).Exec(con()); err != nil {
+		t.Error(err)
+	}
+
+	if err := res.Register.SetString("a").Exec(con()); err != nil {
+		t.Error(err)
+	}
+
+	if calls != 4 {
+		t.Error("unexpected number of middleware calls:", calls)
+	}
+}
+
+func TestMiddlewareHelperAbort(t *testing.T) {
+	type testType struct {
+		Counter *Counter
+	}
+
+	abort := false
+
+	m := func(cmd RunMiddlewarer, next func() (*Result, error)) (*Result, error) {
+		if abort {
+			return nil, errors.New("aborted middleware")
+		}
+
+		return next()
+	}
+
+	key := randomKey()
+
+	_, err := Bucket("middleware", "maps").Set(testType{Counter: NewCounter()}).Key(key).Run(con())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var res testType
+
+	_, err = Bucket("middleware", "maps").RegisterRunMiddleware(m).Get(key, &res).Run(con())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	abort = true
+
+	err = res.Counter.Increase(1).Exec(con())
+	if err == nil || err.Error() != "aborted middleware" {
+		t.Error("unexpected error:", err)
+	}
+}
+
+func TestMiddlewareSetHelpers(t *testing.T) {
+	type testType struct {
+		Counter *Counter
+		Set     *Set
+		Flag    *Flag
+	}
+
+	abort := true
+
+	m := func(cmd RunMiddlewarer, next func() (*Result, error)) (*Result, error) {
+		if abort {
+			return nil, errors.New("aborted middleware")
+		}
+
+		return next()
+	}
+
+	b := Bucket("middleware", "maps").RegisterRunMiddleware(m)
+
+	// The input is not modified when the command is not executed
+	val := &testType{}
+
+	_, err := b.Set(val).Run(con())
+	if err == nil || err.Error() != "aborted middleware" {
+		t.Error("unexpected error:", err)
+	}
+
+	if val.Counter != nil || val.Set != nil || val.Flag != nil {
+		t.Errorf("input was modified: %+v", val)
+	}
+
+	// The helpers are initialized with the generated key after the value has been saved
+	abort = false
+
+	res, err := b.Set(val).Run(con())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if val.Counter == nil || val.Set == nil || val.Flag == nil {
+		t.Errorf("helpers were not initialized: %+v", val)
+		return
+	}
+
+	err = val.Counter.Increase(2).Exec(con())
+	if err != nil {
+		t.Error(err)
+	}
+
+	var out testType
+
+	_, err = b.Get(res.Key, &out).Run(con())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if out.Counter.Value() != 2 {
+		t.Error("unexpected counter value:", out.Counter.Value())
+	}
+}
+
+func TestMiddlewareOperation(t *testing.T) {
+	var cmds []RunMiddlewarer
+
+	m := func(cmd RunMiddlewarer, next func() (*Result, error)) (*Result, error) {
+		cmds = append(cmds, cmd)
+		return next()
+	}
+
+	type testType struct {
+		Name []byte
+		Tags []string
+	}
+
+	key := randomKey()
+	b := Bucket("middleware", "default").RegisterRunMiddleware(m)
+	maps := Bucket("middleware", "maps").RegisterRunMiddleware(m)
+	hlls := Bucket("middleware", "hlls").RegisterRunMiddleware(m)
+
+	var raw []byte
+	var out testType
+
+	b.SetRaw([]byte("hello")).Key(key).WithW(2).WithDw(1).Run(con())
+	b.GetRaw(key, &raw).WithR(2).Run(con())
+	b.SetJSON(map[string]string{"a": "b"}).Key(key).Run(con())
+	b.GetJSON(key, &out).Run(con())
+	b.Delete(key).WithPw(1).Run(con())
+	b.AllKeys(func([]string) error { return nil }).Run(con())
+	b.KeysInIndex("idx_bin", "foo", func(SecondaryIndexQueryResult) {}).Run(con())
+	b.KeysInIndexRange("idx_bin", "a", "z", func(SecondaryIndexQueryResult) {}).Run(con())
+	maps.Set(testType{Name: []byte("abc"), Tags: []string{"de", "f"}}).Key(key).Run(con())
+	maps.Get(key, &out).Run(con())
+	hlls.UpdateHyperLogLog().Key(key).AddMultiple([]byte("ab"), []byte("c")).Run(con())
+	hlls.GetHyperLogLog(key).Run(con())
+
+	type expected struct {
+		op     Operation
+		quorum Quorum
+		size   int
+		value  []byte
+		index  IndexQuery
+	}
+
+	tests := []expected{
+		{op: OperationSetRaw, quorum: Quorum{W: 2, DW: 1}, size: 5, value: []byte("hello")},
+		{op: OperationGetRaw, quorum: Quorum{R: 2}},
+		{op: OperationSetJSON, size: 9, value: []byte(`{"a":"b"}`)},
+		{op: OperationGetJSON},
+		{op: OperationDelete, quorum: Quorum{PW: 1}},
+		{op: OperationAllKeys},
+		{op: OperationKeysInIndex, index: IndexQuery{Name: "idx_bin", Value: "foo"}},
+		{op: OperationKeysInIndexRange, index: IndexQuery{Name: "idx_bin", IsRange: true, Min: "a", Max: "z"}},
+		{op: OperationSet, size: len("Name") + 3 + len("Tags") + 3},
+		{op: OperationGet},
+		{op: OperationUpdateHyperLogLog, size: 3},
+		{op: OperationGetHyperLogLog},
+	}
+
+	if len(cmds) != len(tests) {
+		t.Fatal("unexpected number of commands:", len(cmds))
+	}
+
+	for i, test := range tests {
+		cmd := cmds[i]
+
+		if cmd.Operation() != test.op {
+			t.Errorf("%d: unexpected operation: %s", i, cmd.Operation())
+		}
+
+		if cmd.Operation().IsWrite() != (test.size > 0 || test.op == OperationDelete) {
+			t.Errorf("%d: unexpected IsWrite", i)
+		}
+
+		if cmd.Quorum() != test.quorum {
+			t.Errorf("%d: unexpected quorum: %+v", i, cmd.Quorum())
+		}
+
+		if cmd.Size() != test.size {
+			t.Errorf("%d: unexpected size: %d", i, cmd.Size())
+		}
+
+		if !reflect.DeepEqual(cmd.Value(), test.value) {
+			t.Errorf("%d: unexpected value: %s", i, cmd.Value())
+		}
+
+		if cmd.Index() != test.index {
+			t.Errorf("%d: unexpected index: %+v", i, cmd.Index())
+		}
+	}
+}
+
+func TestMiddlewareReadOnly(t *testing.T) {
+	errReadOnly := errors.New("read only")
+
+	m := func(cmd RunMiddlewarer, next func() (*Result, error)) (*Result, error) {
+		if cmd.Operation().IsWrite() {
+			return nil, errReadOnly
+		}
+
+		return next()
+	}
+
+	b := Bucket("middleware", "default").RegisterRunMiddleware(m)
+
+	if _, err := b.Delete(randomKey()).Run(con()); err != errReadOnly {
+		t.Error("unexpected error:", err)
+	}
+
+	if _, err := b.SetRaw([]byte("a")).Run(con()); err != errReadOnly {
+		t.Error("unexpected error:", err)
+	}
+
+	var raw []byte
+
+	if _, err := b.GetRaw(randomKey(), &raw).Run(con()); err != ErrNotFound {
+		t.Error("unexpected error:", err)
+	}
+}
+
+func TestMapOperationSize(t *testing.T) {
+	op := NewMapOperation()
+	op.IncrementCounter("counter", 1)
+	op.SetFlag("flag", true)
+	op.SetRegister("reg", []byte("abc"))
+	op.AddToSet("set", []byte("ab"))
+	op.AddToSet("set", []byte("c"))
+	op.Map("sub").SetRegister("r", []byte("d"))
+
+	expected := len("counter") + 8 + len("flag") + 1 + len("reg") + 3 + len("set") + 3 + len("sub") + len("r") + 1
+
+	if size := mapOperationSize(reflect.ValueOf(&op)); size != expected {
+		t.Errorf("unexpected size: %d, expected %d", size, expected)
+	}
+}
+
+func TestSessionUse(t *testing.T) {
+	var order []string
+
+	m := func(name string) RunMiddleware {
+		return func(cmd RunMiddlewarer, next func() (*Result, error)) (*Result, error) {
+			order = append(order, name)
+			return next()
+		}
+	}
+
+	session := NewMemorySession()
+	defer session.Close()
+
+	session.Use(m("session1"), m("session2")).Use(m("session3"))
+
+	_, err := Bucket("middleware", "default").
+		RegisterRunMiddleware(m("command1")).
+		RegisterRunMiddleware(m("command2")).
+		SetRaw([]byte("a")).
+		Run(session)
+	if err != nil {
+		t.Error(err)
+	}
+
+	expected := []string{"session1", "session2", "session3", "command1", "command2"}
+
+	if !reflect.DeepEqual(order, expected) {
+		t.Error("unexpected order:", order)
+	}
+
+	// Commands without middleware
+	order = nil
+
+	_, err = Bucket("middleware", "default").Delete("foo").Run(session)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !reflect.DeepEqual(order, expected[:3]) {
+		t.Error("unexpected order:", order)
+	}
+
+	// Other sessions are not affected
+	order = nil
+
+	_, err = Bucket("middleware", "default").Delete("foo").Run(NewMemorySession())
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(order) != 0 {
+		t.Error("unexpected order:", order)
+	}
+}
+
+func TestSessionUseHelperExec(t *testing.T) {
+	type testType struct {
+		Counter *Counter
+	}
+
+	calls := 0
+
+	session := NewMemorySession()
+	defer session.Close()
+
+	key := randomKey()
+
+	_, err := Bucket("middleware", "maps").Set(testType{Counter: NewCounter()}).Key(key).Run(session)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var res testType
+
+	_, err = Bucket("middleware", "maps").Get(key, &res).Run(session)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	session.Use(func(cmd RunMiddlewarer, next func() (*Result, error)) (*Result, error) {
+		calls++
+		return next()
+	})
+
+	if err := res.Counter.Increase(1).Exec(session); err != nil {
+		t.Error(err)
+	}
+
+	if calls != 1 {
+		t.Error("unexpected number of calls:", calls)
+	}
+}
+
+func TestMiddlewareConflictWriteBack(t *testing.T) {
+	key := randomKey()
+
+	Bucket("sibs", "tests").SetRaw([]byte("a")).Key(key).Run(con())
+	Bucket("sibs", "tests").SetRaw([]byte("b")).Key(key).Run(con())
+
+	var ops []string
+
+	m := func(cmd RunMiddlewarer, next func() (*Result, error)) (*Result, error) {
+		op := string(cmd.Operation())
+		if cmd.ConflictWriteBack() {
+			op += " write-back"
+		}
+
+		ops = append(ops, op)
+
+		return next()
+	}
+
+	var out []byte
+
+	res, err := Bucket("sibs", "tests").
+		RegisterRunMiddleware(m).
+		GetRaw(key, &out).
+		ConflictResolver(func(objs []ConflictObject) ResolvedConflict {
+			return objs[0].GetResolved()
+		}).
+		Run(con())
+	if err != nil {
+		t.Error(err)
+	}
+
+	if res.Siblings != 2 {
+		t.Error("unexpected siblings:", res.Siblings)
+	}
+
+	if !reflect.DeepEqual(ops, []string{"get_raw", "set_raw write-back"}) {
+		t.Error("unexpected operations:", ops)
+	}
+}
@@ -0,0 +1,188 @@
+package goriak
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	riak "github.com/basho/riak-go-client"
+)
+
+// defaultNodeResolverInterval is used if NodeResolverInterval is not set
+const defaultNodeResolverInterval = 30 * time.Second
+
+// AddNode adds a new node to the Session. The node uses the same options as the nodes that were added by Connect,
+// such as the default port, credentials and connection pool options. Adding a node that already exists is a no-op.
+func (c *Session) AddNode(address string) error {
+	if err := c.begin(); err != nil {
+		return err
+	}
+
+	defer c.inflight.Done()
+
+	return c.backend.addNode(address)
+}
+
+// RemoveNode stops and removes a node from the Session. The address can be written with or without the port.
+func (c *Session) RemoveNode(address string) error {
+	if err := c.begin(); err != nil {
+		return err
+	}
+
+	defer c.inflight.Done()
+
+	return c.backend.removeNode(address)
+}
+
+// ResolveNodes calls ConnectOpts.NodeResolver, and adds and removes nodes so that the Session uses the
+// same nodes as was returned by the resolver. ResolveNodes is called periodically if NodeResolver is set,
+// but it can also be called manually to force an update of the nodes.
+//
+// The nodes are kept unmodified if the resolver returns an error, or no addresses.
+func (c *Session) ResolveNodes(ctx context.Context) error {
+	if c.opts.NodeResolver == nil {
+		return errors.New("goriak: NodeResolver is not set")
+	}
+
+	addresses, err := c.opts.NodeResolver(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(addresses) == 0 {
+		return errors.New("goriak: NodeResolver returned no addresses")
+	}
+
+	wanted := make(map[string]struct{}, len(addresses))
+
+	for _, address := range addresses {
+		wanted[c.opts.address(address)] = struct{}{}
+
+		if err := c.AddNode(address); err != nil {
+			return err
+		}
+	}
+
+	for _, node := range c.backend.health() {
+		if _, ok := wanted[node.Address]; ok {
+			continue
+		}
+
+		if err := c.RemoveNode(node.Address); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// startNodeResolver calls ResolveNodes every NodeResolverInterval until the Session is closed
+func (c *Session) startNodeResolver() {
+	interval := c.opts.NodeResolverInterval
+	if interval <= 0 {
+		interval = defaultNodeResolverInterval
+	}
+
+	c.stopResolver = make(chan struct{})
+	c.resolverDone = make(chan struct{})
+
+	go func() {
+		defer close(c.resolverDone)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		go func() {
+			<-c.stopResolver
+			cancel()
+		}()
+
+		for {
+			select {
+			case <-ticker.C:
+				// Errors are ignored, the nodes are kept unmodified until the next successful resolve
+				c.ResolveNodes(ctx)
+			case <-c.stopResolver:
+				return
+			}
+		}
+	}()
+}
+
+// newNode creates a new node for configAddress, using the options from ConnectOpts
+func (b *riakBackend) newNode(configAddress string) (*riakNode, error) {
+	address := b.opts.address(configAddress)
+
+	nodeOpts, err := b.opts.nodeOptions(configAddress, address)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeOpts.AuthOptions = nodeAuthOptions(b.auth, address)
+
+	node, err := riak.NewNode(nodeOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &riakNode{
+		node:    node,
+		address: address,
+	}, nil
+}
+
+// addNode creates and starts a new node, and adds it to the cluster
+func (b *riakBackend) addNode(configAddress string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	address := b.opts.address(configAddress)
+
+	for _, node := range b.nodes {
+		if node.address == address {
+			return nil
+		}
+	}
+
+	node, err := b.newNode(configAddress)
+	if err != nil {
+		return err
+	}
+
+	err = b.cluster.AddNode(node.node)
+	if err != nil {
+		return err
+	}
+
+	b.nodes = append(b.nodes, node)
+
+	return nil
+}
+
+// removeNode stops the node and removes it from the cluster
+func (b *riakBackend) removeNode(configAddress string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	address := b.opts.address(configAddress)
+
+	for i, node := range b.nodes {
+		if node.address != address {
+			continue
+		}
+
+		err := b.cluster.RemoveNode(node.node)
+		if err != nil {
+			return err
+		}
+
+		b.nodes = append(b.nodes[:i:i], b.nodes[i+1:]...)
+
+		return nil
+	}
+
+	return errors.New("goriak: unknown node: " + configAddress)
+}
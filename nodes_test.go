@@ -0,0 +1,130 @@
+package goriak
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func nodeAddresses(c *Session) []string {
+	var res []string
+
+	for _, node := range c.Health().Nodes {
+		res = append(res, node.Address)
+	}
+
+	sort.Strings(res)
+
+	return res
+}
+
+func TestAddRemoveNode(t *testing.T) {
+	c, err := Connect(ConnectOpts{
+		Addresses: []string{"127.0.0.1"},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	defer c.Close()
+
+	err = c.AddNode("localhost")
+	if err != nil {
+		t.Error(err)
+	}
+
+	// Adding the same node twice is a no-op
+	err = c.AddNode("localhost:8087")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if addresses := nodeAddresses(c); !reflect.DeepEqual(addresses, []string{"127.0.0.1:8087", "localhost:8087"}) {
+		t.Error("unexpected nodes:", addresses)
+	}
+
+	err = c.RemoveNode("127.0.0.1")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if addresses := nodeAddresses(c); !reflect.DeepEqual(addresses, []string{"localhost:8087"}) {
+		t.Error("unexpected nodes:", addresses)
+	}
+
+	err = c.RemoveNode("127.0.0.1")
+	if err == nil {
+		t.Error("no error when removing unknown node")
+	}
+}
+
+func TestNodeResolver(t *testing.T) {
+	var mu sync.Mutex
+	addresses := []string{"127.0.0.1"}
+	var resolveErr error
+
+	c, err := Connect(ConnectOpts{
+		Addresses: []string{"127.0.0.1"},
+		NodeResolver: func(ctx context.Context) ([]string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return addresses, resolveErr
+		},
+		NodeResolverInterval: 5 * time.Millisecond,
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	waitFor := func(expected []string) {
+		for i := 0; i < 100; i++ {
+			if reflect.DeepEqual(nodeAddresses(c), expected) {
+				return
+			}
+
+			time.Sleep(5 * time.Millisecond)
+		}
+
+		t.Error("unexpected nodes:", nodeAddresses(c))
+	}
+
+	mu.Lock()
+	addresses = []string{"127.0.0.1", "localhost"}
+	mu.Unlock()
+
+	waitFor([]string{"127.0.0.1:8087", "localhost:8087"})
+
+	mu.Lock()
+	addresses = []string{"localhost"}
+	mu.Unlock()
+
+	waitFor([]string{"localhost:8087"})
+
+	// Errors from the resolver keeps the nodes unmodified
+	mu.Lock()
+	resolveErr = errors.New("lookup failed")
+	mu.Unlock()
+
+	if err := c.ResolveNodes(context.Background()); err != resolveErr {
+		t.Error("unexpected error:", err)
+	}
+
+	if addresses := nodeAddresses(c); !reflect.DeepEqual(addresses, []string{"localhost:8087"}) {
+		t.Error("unexpected nodes:", addresses)
+	}
+
+	err = c.Close()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if err := c.AddNode("127.0.0.1"); !errors.Is(err, ErrSessionClosed) {
+		t.Error("unexpected error:", err)
+	}
+}
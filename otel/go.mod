@@ -0,0 +1,25 @@
+module github.com/zegl/goriak/v3/otel
+
+go 1.21
+
+require (
+	github.com/zegl/goriak/v3 v3.3.0
+	go.opentelemetry.io/otel v1.28.0
+	go.opentelemetry.io/otel/sdk v1.28.0
+	go.opentelemetry.io/otel/trace v1.28.0
+)
+
+require (
+	github.com/basho/backoff v0.0.0-20150307023525-2ff7c4694083 // indirect
+	github.com/basho/riak-go-client v0.0.0-20170327205844-5587c16e0b8b // indirect
+	github.com/go-logr/logr v1.4.2 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/golang/protobuf v1.1.0 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	go.opentelemetry.io/otel/metric v1.28.0 // indirect
+	golang.org/x/sys v0.21.0 // indirect
+)
+
+// The goriak in the parent directory is used when developing in this repository.
+// Replace directives are ignored when the module is used as a dependency.
+replace github.com/zegl/goriak/v3 => ../
@@ -0,0 +1,135 @@
+// Package otel provides a goriak middleware that traces commands with OpenTelemetry.
+//
+//	session.Use(otel.Middleware())
+package otel
+
+import (
+	"errors"
+
+	goriak "github.com/zegl/goriak/v3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/zegl/goriak/v3/otel"
+
+// Attribute keys set on the spans
+const (
+	BucketKey     = attribute.Key("riak.bucket")
+	BucketTypeKey = attribute.Key("riak.bucket_type")
+	KeyKey        = attribute.Key("riak.key")
+	OperationKey  = attribute.Key("riak.operation")
+	RKey          = attribute.Key("riak.r")
+	PRKey         = attribute.Key("riak.pr")
+	WKey          = attribute.Key("riak.w")
+	PWKey         = attribute.Key("riak.pw")
+	DWKey         = attribute.Key("riak.dw")
+	SizeKey       = attribute.Key("riak.size")
+	IndexKey      = attribute.Key("riak.index")
+	NotFoundKey   = attribute.Key("riak.not_found")
+	SiblingsKey   = attribute.Key("riak.siblings")
+)
+
+type config struct {
+	tracerProvider trace.TracerProvider
+}
+
+// Option configures the middleware
+type Option func(*config)
+
+// WithTracerProvider sets the TracerProvider that is used to create spans.
+// Defaults to the global TracerProvider.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(c *config) {
+		c.tracerProvider = provider
+	}
+}
+
+// Middleware returns a middleware that creates a span for every command. The span is a child
+// of the span in the context that the command is executed with (RunContext).
+//
+// The span is named after the operation, such as "riak get_raw", and has the bucket, bucket type,
+// key, operation and quorum values as attributes. Get, GetRaw and GetJSON commands also have the
+// result as attributes, if the key was not found, and the number of siblings that were resolved.
+// ErrNotFound is not recorded as an error.
+func Middleware(opts ...Option) goriak.RunMiddleware {
+	conf := config{
+		tracerProvider: otel.GetTracerProvider(),
+	}
+
+	for _, opt := range opts {
+		opt(&conf)
+	}
+
+	tracer := conf.tracerProvider.Tracer(instrumentationName)
+
+	return func(cmd goriak.RunMiddlewarer, next func() (*goriak.Result, error)) (*goriak.Result, error) {
+		op := cmd.Operation()
+
+		attrs := []attribute.KeyValue{
+			attribute.String("db.system", "riak"),
+			attribute.String("db.operation", string(op)),
+			OperationKey.String(string(op)),
+			BucketKey.String(cmd.Bucket()),
+			BucketTypeKey.String(cmd.BucketType()),
+		}
+
+		quorum := cmd.Quorum()
+
+		for _, q := range []struct {
+			key   attribute.Key
+			value uint32
+		}{
+			{RKey, quorum.R},
+			{PRKey, quorum.PR},
+			{WKey, quorum.W},
+			{PWKey, quorum.PW},
+			{DWKey, quorum.DW},
+		} {
+			if q.value > 0 {
+				attrs = append(attrs, q.key.Int64(int64(q.value)))
+			}
+		}
+
+		if op.IsWrite() {
+			attrs = append(attrs, SizeKey.Int(cmd.Size()))
+		}
+
+		if index := cmd.Index(); index.Name != "" {
+			attrs = append(attrs, IndexKey.String(index.Name))
+		}
+
+		_, span := tracer.Start(cmd.Context(), "riak "+string(op),
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attrs...),
+		)
+		defer span.End()
+
+		res, err := next()
+
+		// The key is known after the command has been executed if it was generated by Riak
+		if key := cmd.Key(); key != "" {
+			span.SetAttributes(KeyKey.String(key))
+		}
+
+		if res != nil {
+			switch op {
+			case goriak.OperationGet, goriak.OperationGetRaw, goriak.OperationGetJSON, goriak.OperationGetHyperLogLog:
+				span.SetAttributes(NotFoundKey.Bool(res.NotFound))
+			}
+
+			if res.Siblings > 0 {
+				span.SetAttributes(SiblingsKey.Int(res.Siblings))
+			}
+		}
+
+		if err != nil && !errors.Is(err, goriak.ErrNotFound) {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+
+		return res, err
+	}
+}
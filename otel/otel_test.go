@@ -0,0 +1,168 @@
+package otel
+
+import (
+	"context"
+	"testing"
+
+	goriak "github.com/zegl/goriak/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func setup() (*goriak.Session, *tracetest.InMemoryExporter, *sdktrace.TracerProvider) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	session := goriak.NewMemorySession()
+	session.Use(Middleware(WithTracerProvider(provider)))
+
+	return session, exporter, provider
+}
+
+func attributes(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	res := make(map[attribute.Key]attribute.Value)
+
+	for _, attr := range span.Attributes {
+		res[attr.Key] = attr.Value
+	}
+
+	return res
+}
+
+func TestMiddleware(t *testing.T) {
+	session, exporter, provider := setup()
+
+	// Parent span
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+
+	_, err := goriak.Bucket("bucket", "default").
+		SetRaw([]byte("hello")).
+		Key("key").
+		WithW(2).
+		RunContext(ctx, session)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parent.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatal("unexpected number of spans:", len(spans))
+	}
+
+	span := spans[0]
+
+	if span.Name != "riak set_raw" || span.SpanKind != trace.SpanKindClient {
+		t.Error("unexpected span:", span.Name, span.SpanKind)
+	}
+
+	if span.Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Error("span is not a child of the parent span")
+	}
+
+	attrs := attributes(span)
+
+	expected := map[attribute.Key]attribute.Value{
+		"db.system":   attribute.StringValue("riak"),
+		OperationKey:  attribute.StringValue("set_raw"),
+		BucketKey:     attribute.StringValue("bucket"),
+		BucketTypeKey: attribute.StringValue("default"),
+		KeyKey:        attribute.StringValue("key"),
+		WKey:          attribute.Int64Value(2),
+		SizeKey:       attribute.IntValue(5),
+	}
+
+	for key, value := range expected {
+		if attrs[key] != value {
+			t.Errorf("%s: unexpected value %v", key, attrs[key].Emit())
+		}
+	}
+
+	if _, ok := attrs[RKey]; ok {
+		t.Error("unexpected R attribute")
+	}
+
+	if span.Status.Code != codes.Unset {
+		t.Error("unexpected status:", span.Status)
+	}
+}
+
+func TestMiddlewareNotFound(t *testing.T) {
+	session, exporter, _ := setup()
+
+	var out []byte
+
+	_, err := goriak.Bucket("bucket", "default").GetRaw("missing", &out).Run(session)
+	if err != goriak.ErrNotFound {
+		t.Fatal("unexpected error:", err)
+	}
+
+	span := exporter.GetSpans()[0]
+
+	if attributes(span)[NotFoundKey] != attribute.BoolValue(true) {
+		t.Error("not found is not set")
+	}
+
+	if span.Status.Code != codes.Unset || len(span.Events) != 0 {
+		t.Error("not found was recorded as an error")
+	}
+}
+
+func TestMiddlewareSiblings(t *testing.T) {
+	session, exporter, _ := setup()
+
+	goriak.Bucket("sibs", "tests").SetRaw([]byte("a")).Key("key").Run(session)
+	goriak.Bucket("sibs", "tests").SetRaw([]byte("b")).Key("key").Run(session)
+
+	exporter.Reset()
+
+	var out []byte
+
+	_, err := goriak.Bucket("sibs", "tests").
+		GetRaw("key", &out).
+		ConflictResolver(func(objs []goriak.ConflictObject) goriak.ResolvedConflict {
+			return objs[0].GetResolved()
+		}).
+		Run(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The GetRaw span, and the SetRaw span that saves the resolved value
+	var found bool
+
+	for _, span := range exporter.GetSpans() {
+		if span.Name == "riak get_raw" {
+			found = true
+
+			if attributes(span)[SiblingsKey] != attribute.IntValue(2) {
+				t.Error("unexpected siblings:", attributes(span)[SiblingsKey].Emit())
+			}
+		}
+	}
+
+	if !found {
+		t.Error("no get_raw span")
+	}
+}
+
+func TestMiddlewareError(t *testing.T) {
+	session, exporter, _ := setup()
+	session.Close()
+
+	goriak.Bucket("bucket", "default").Delete("key").Run(session)
+
+	span := exporter.GetSpans()[0]
+
+	if span.Status.Code != codes.Error || span.Status.Description != goriak.ErrSessionClosed.Error() {
+		t.Error("unexpected status:", span.Status)
+	}
+
+	if len(span.Events) != 1 || span.Events[0].Name != "exception" {
+		t.Error("error was not recorded")
+	}
+}
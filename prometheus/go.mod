@@ -0,0 +1,28 @@
+module github.com/zegl/goriak/v3/prometheus
+
+go 1.21
+
+require (
+	github.com/prometheus/client_golang v1.20.5
+	github.com/zegl/goriak/v3 v3.3.0
+)
+
+require (
+	github.com/basho/backoff v0.0.0-20150307023525-2ff7c4694083 // indirect
+	github.com/basho/riak-go-client v0.0.0-20170327205844-5587c16e0b8b // indirect
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/golang/protobuf v1.5.3 // indirect
+	github.com/kylelemons/godebug v1.1.0 // indirect
+	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
+	github.com/prometheus/client_model v0.6.1 // indirect
+	github.com/prometheus/common v0.55.0 // indirect
+	github.com/prometheus/procfs v0.15.1 // indirect
+	golang.org/x/sys v0.22.0 // indirect
+	google.golang.org/protobuf v1.34.2 // indirect
+)
+
+// The goriak in the parent directory is used when developing in this repository.
+// Replace directives are ignored when the module is used as a dependency.
+replace github.com/zegl/goriak/v3 => ../
@@ -0,0 +1,190 @@
+// Package prometheus provides a goriak middleware that collects Prometheus metrics.
+//
+//	metrics := prometheus.New()
+//	registry.MustRegister(metrics)
+//	session.Use(metrics.Middleware)
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	goriak "github.com/zegl/goriak/v3"
+)
+
+// Metrics collects metrics of goriak commands. Metrics is a prometheus.Collector and needs to be registered
+// before the metrics are exported.
+//
+// The following metrics are collected, with the namespace "goriak" by default:
+//
+//	goriak_commands_total{operation,bucket_type}                 Commands executed
+//	goriak_command_duration_seconds{operation,bucket_type}       Latency of commands, including retries by later middleware
+//	goriak_not_found_total{operation,bucket_type}                Commands where the key was not found
+//	goriak_errors_total{operation,bucket_type,type}              Failed commands, by the type of error (see ErrorType)
+//	goriak_sibling_resolutions_total{bucket_type}                Conflicts resolved by a conflict resolver in GetRaw and GetJSON
+//	goriak_conflict_write_backs_total{bucket_type,result}        Saves of the resolved value, result is "success" or "error"
+type Metrics struct {
+	commands          *prometheus.CounterVec
+	duration          *prometheus.HistogramVec
+	notFound          *prometheus.CounterVec
+	errors            *prometheus.CounterVec
+	siblingResolution *prometheus.CounterVec
+	writeBacks        *prometheus.CounterVec
+}
+
+type config struct {
+	namespace string
+	buckets   []float64
+}
+
+// Option configures Metrics
+type Option func(*config)
+
+// WithNamespace sets the namespace of the metrics. Defaults to "goriak".
+func WithNamespace(namespace string) Option {
+	return func(c *config) {
+		c.namespace = namespace
+	}
+}
+
+// WithBuckets sets the buckets of the latency histogram. Defaults to prometheus.DefBuckets.
+func WithBuckets(buckets []float64) Option {
+	return func(c *config) {
+		c.buckets = buckets
+	}
+}
+
+// New creates Metrics
+func New(opts ...Option) *Metrics {
+	conf := config{
+		namespace: "goriak",
+		buckets:   prometheus.DefBuckets,
+	}
+
+	for _, opt := range opts {
+		opt(&conf)
+	}
+
+	labels := []string{"operation", "bucket_type"}
+
+	return &Metrics{
+		commands: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: conf.namespace,
+			Name:      "commands_total",
+			Help:      "Number of executed Riak commands.",
+		}, labels),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: conf.namespace,
+			Name:      "command_duration_seconds",
+			Help:      "Latency of Riak commands.",
+			Buckets:   conf.buckets,
+		}, labels),
+		notFound: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: conf.namespace,
+			Name:      "not_found_total",
+			Help:      "Number of Riak commands where the key was not found.",
+		}, labels),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: conf.namespace,
+			Name:      "errors_total",
+			Help:      "Number of failed Riak commands.",
+		}, append(labels, "type")),
+		siblingResolution: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: conf.namespace,
+			Name:      "sibling_resolutions_total",
+			Help:      "Number of siblings resolved by a conflict resolver.",
+		}, []string{"bucket_type"}),
+		writeBacks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: conf.namespace,
+			Name:      "conflict_write_backs_total",
+			Help:      "Number of saves of values chosen by a conflict resolver.",
+		}, []string{"bucket_type", "result"}),
+	}
+}
+
+func (m *Metrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.commands, m.duration, m.notFound, m.errors, m.siblingResolution, m.writeBacks}
+}
+
+// Describe implements prometheus.Collector
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range m.collectors() {
+		c.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range m.collectors() {
+		c.Collect(ch)
+	}
+}
+
+// Middleware is a goriak.RunMiddleware that collects the metrics of the command
+func (m *Metrics) Middleware(cmd goriak.RunMiddlewarer, next func() (*goriak.Result, error)) (*goriak.Result, error) {
+	op := string(cmd.Operation())
+	bucketType := cmd.BucketType()
+
+	start := time.Now()
+	res, err := next()
+	m.duration.WithLabelValues(op, bucketType).Observe(time.Since(start).Seconds())
+
+	m.commands.WithLabelValues(op, bucketType).Inc()
+
+	switch {
+	case errors.Is(err, goriak.ErrNotFound) || (err == nil && res != nil && res.NotFound):
+		m.notFound.WithLabelValues(op, bucketType).Inc()
+	case err != nil:
+		m.errors.WithLabelValues(op, bucketType, ErrorType(err)).Inc()
+	}
+
+	if res != nil && res.Siblings > 0 {
+		m.siblingResolution.WithLabelValues(bucketType).Inc()
+	}
+
+	if cmd.ConflictWriteBack() {
+		result := "success"
+		if err != nil {
+			result = "error"
+		}
+
+		m.writeBacks.WithLabelValues(bucketType, result).Inc()
+	}
+
+	return res, err
+}
+
+// ErrorType returns the type of err that is used as the type label of goriak_errors_total.
+// It is one of "canceled", "deadline_exceeded", "session_closed", "circuit_open", "rate_limited", "conflict", "unsupported_type",
+// "uninitialized", "transient" (see goriak.IsTransient), "riak" (other errors returned by Riak) or "other".
+func ErrorType(err error) string {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "deadline_exceeded"
+	case errors.Is(err, goriak.ErrSessionClosed):
+		return "session_closed"
+	case errors.Is(err, goriak.ErrCircuitOpen):
+		return "circuit_open"
+	case errors.Is(err, goriak.ErrRateLimited):
+		return "rate_limited"
+	case errors.Is(err, goriak.ErrConflictUnresolved), errors.Is(err, goriak.ErrInvalidResolverResult):
+		return "conflict"
+	case errors.Is(err, goriak.ErrUnsupportedType):
+		return "unsupported_type"
+	case errors.Is(err, goriak.ErrUninitialized):
+		return "uninitialized"
+	case goriak.IsTransient(err):
+		return "transient"
+	}
+
+	var riakErr *goriak.RiakError
+	if errors.As(err, &riakErr) {
+		return "riak"
+	}
+
+	return "other"
+}
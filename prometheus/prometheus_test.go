@@ -0,0 +1,133 @@
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	goriak "github.com/zegl/goriak/v3"
+)
+
+func setup(t *testing.T) (*goriak.Session, *Metrics) {
+	metrics := New()
+
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(metrics); err != nil {
+		t.Fatal(err)
+	}
+
+	session := goriak.NewMemorySession()
+	session.Use(metrics.Middleware)
+
+	return session, metrics
+}
+
+func TestMiddleware(t *testing.T) {
+	session, metrics := setup(t)
+
+	goriak.Bucket("bucket", "default").SetRaw([]byte("a")).Key("a").Run(session)
+	goriak.Bucket("bucket", "default").SetRaw([]byte("b")).Key("b").Run(session)
+
+	var out []byte
+	goriak.Bucket("bucket", "default").GetRaw("a", &out).Run(session)
+	goriak.Bucket("bucket", "default").GetRaw("missing", &out).Run(session)
+
+	expected := `
+# HELP goriak_commands_total Number of executed Riak commands.
+# TYPE goriak_commands_total counter
+goriak_commands_total{bucket_type="default",operation="get_raw"} 2
+goriak_commands_total{bucket_type="default",operation="set_raw"} 2
+# HELP goriak_not_found_total Number of Riak commands where the key was not found.
+# TYPE goriak_not_found_total counter
+goriak_not_found_total{bucket_type="default",operation="get_raw"} 1
+`
+
+	err := testutil.CollectAndCompare(metrics, strings.NewReader(expected), "goriak_commands_total", "goriak_not_found_total", "goriak_errors_total")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if count := testutil.CollectAndCount(metrics, "goriak_command_duration_seconds"); count != 2 {
+		t.Error("unexpected number of histograms:", count)
+	}
+}
+
+func TestMiddlewareSiblings(t *testing.T) {
+	session, metrics := setup(t)
+
+	goriak.Bucket("sibs", "tests").SetRaw([]byte("a")).Key("key").Run(session)
+	goriak.Bucket("sibs", "tests").SetRaw([]byte("b")).Key("key").Run(session)
+
+	var out []byte
+
+	_, err := goriak.Bucket("sibs", "tests").
+		GetRaw("key", &out).
+		ConflictResolver(func(objs []goriak.ConflictObject) goriak.ResolvedConflict {
+			return objs[0].GetResolved()
+		}).
+		Run(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `
+# HELP goriak_sibling_resolutions_total Number of siblings resolved by a conflict resolver.
+# TYPE goriak_sibling_resolutions_total counter
+goriak_sibling_resolutions_total{bucket_type="tests"} 1
+# HELP goriak_conflict_write_backs_total Number of saves of values chosen by a conflict resolver.
+# TYPE goriak_conflict_write_backs_total counter
+goriak_conflict_write_backs_total{bucket_type="tests",result="success"} 1
+`
+
+	err = testutil.CollectAndCompare(metrics, strings.NewReader(expected), "goriak_sibling_resolutions_total", "goriak_conflict_write_backs_total")
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMiddlewareErrors(t *testing.T) {
+	session, metrics := setup(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	goriak.Bucket("bucket", "default").Delete("key").RunContext(ctx, session)
+
+	session.Close()
+
+	goriak.Bucket("bucket", "default").Delete("key").Run(session)
+
+	expected := `
+# HELP goriak_errors_total Number of failed Riak commands.
+# TYPE goriak_errors_total counter
+goriak_errors_total{bucket_type="default",operation="delete",type="canceled"} 1
+goriak_errors_total{bucket_type="default",operation="delete",type="session_closed"} 1
+`
+
+	err := testutil.CollectAndCompare(metrics, strings.NewReader(expected), "goriak_errors_total")
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestErrorType(t *testing.T) {
+	tests := map[error]string{
+		context.DeadlineExceeded:                                "deadline_exceeded",
+		fmt.Errorf("wrapped: %w", goriak.ErrConflictUnresolved): "conflict",
+		goriak.ErrUnsupportedType:                               "unsupported_type",
+		&goriak.CircuitOpenError{Circuit: "maps"}:               "circuit_open",
+		goriak.ErrRateLimited:                                   "rate_limited",
+		goriak.ErrUninitialized:                                 "uninitialized",
+		errors.New("unknown"):                                   "other",
+	}
+
+	for err, expected := range tests {
+		if typ := ErrorType(err); typ != expected {
+			t.Errorf("%v: unexpected type %s", err, typ)
+		}
+	}
+}
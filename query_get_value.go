@@ -1,13 +1,13 @@
 package goriak
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	riak "github.com/basho/riak-go-client"
 )
 
 type GetRawCommand struct {
-	builder *riak.FetchValueCommandBuilder
+	req *fetchValueRequest
 
 	c *Command
 
@@ -33,7 +33,7 @@ func (c *GetRawCommand) ConflictResolver(fn func([]ConflictObject) ResolvedConfl
 	return c
 }
 
-func (c *GetRawCommand) fetchValueWithResolver(session *Session, values []*riak.Object) ([]byte, []byte, error) {
+func (c *GetRawCommand) fetchValueWithResolver(ctx context.Context, session *Session, values []*riak.Object) ([]byte, []byte, error) {
 
 	// Conflict resolution necessary
 	if len(values) > 1 {
@@ -45,7 +45,7 @@ func (c *GetRawCommand) fetchValueWithResolver(session *Session, values []*riak.
 			if resolver, ok := c.output.(ConflictResolver); ok {
 				c.conflictResolverFunc = resolver.ConflictResolver
 			} else {
-				return []byte{}, []byte{}, errors.New("goriak: Had conflict, but no conflict resolver")
+				return []byte{}, []byte{}, ErrConflictUnresolved
 			}
 		}
 
@@ -62,15 +62,20 @@ func (c *GetRawCommand) fetchValueWithResolver(session *Session, values []*riak.
 		useObj := c.conflictResolverFunc(objs)
 
 		if len(useObj.VClock) == 0 {
-			return []byte{}, []byte{}, errors.New("goriak: Invalid value from conflict resolver")
+			return []byte{}, []byte{}, ErrInvalidResolverResult
 		}
 
 		// Save resolution
-		Bucket(c.bucket, c.bucketType).
+		writeBack := Bucket(c.bucket, c.bucketType).
 			SetRaw(useObj.Value).
 			Key(c.key).
-			WithContext(useObj.VClock).
-			Run(session)
+			WithContext(useObj.VClock)
+
+		// Use the same middleware as the command
+		writeBack.c.runMiddleware = c.c.runMiddleware
+		writeBack.isConflictWriteBack = true
+
+		writeBack.RunContext(ctx, session)
 
 		return useObj.Value, useObj.VClock, nil
 	}
@@ -79,82 +84,120 @@ func (c *GetRawCommand) fetchValueWithResolver(session *Session, values []*riak.
 }
 
 func (c *GetRawCommand) WithPr(pr uint32) *GetRawCommand {
-	c.builder.WithPr(pr)
+	c.req.pr = pr
 	return c
 }
 
 func (c *GetRawCommand) WithR(r uint32) *GetRawCommand {
-	c.builder.WithR(r)
+	c.req.r = r
 	return c
 }
 
-func runMiddleware(middlewarer RunMiddlewarer, middlewareList []RunMiddleware, execFunc func(*Session) (*Result, error), session *Session) (*Result, error) {
-	// Keep track of whick middleware that we should execute next
-	middlewareI := 0
+func runMiddleware(ctx context.Context, middlewarer *commandMiddlewarer, middlewareList []RunMiddleware, execFunc func(context.Context, *Session) (*Result, error), session *Session) (*Result, error) {
+	// Session middleware wraps the command middleware
+	if sessionMiddleware := session.sessionMiddleware(); len(sessionMiddleware) > 0 {
+		middlewareList = append(sessionMiddleware[:len(sessionMiddleware):len(sessionMiddleware)], middlewareList...)
+	}
 
-	// Needed so that next can call itself
-	var next2 func() (*Result, error)
+	// next returns the function that calls middleware number i, so that a middleware can call next more than once
+	var next func(i int) func() (*Result, error)
 
-	next := func() (*Result, error) {
-		if middlewareI == len(middlewareList) {
-			return execFunc(session)
-		}
+	next = func(i int) func() (*Result, error) {
+		return func() (*Result, error) {
+			if i == len(middlewareList) {
+				res, err := execFunc(ctx, session)
 
-		middlewareI++
+				// Make keys generated by Riak available to the middleware
+				if res != nil && res.Key != "" {
+					middlewarer.key = res.Key
+				}
 
-		return middlewareList[middlewareI-1](middlewarer, next2)
-	}
+				return res, err
+			}
 
-	next2 = next
+			return middlewareList[i](middlewarer, next(i+1))
+		}
+	}
 
-	return next()
+	return next(0)()
 }
 
 func (c *GetRawCommand) Run(session *Session) (*Result, error) {
-	middlewarer := &getRawMiddlewarer{
-		cmd: c,
+	return c.RunContext(context.Background(), session)
+}
+
+// RunContext is the same as Run, but aborts the command when ctx is cancelled or reaches its deadline
+func (c *GetRawCommand) RunContext(ctx context.Context, session *Session) (*Result, error) {
+	middlewarer := &commandMiddlewarer{
+		key:        c.key,
+		bucket:     c.bucket,
+		bucketType: c.bucketType,
+		ctx:        ctx,
+		operation:  OperationGetJSON,
+		quorum:     c.req.quorum,
 	}
 
-	return runMiddleware(middlewarer, c.c.runMiddleware, c.runExec, session)
-}
+	if c.isRawOutput {
+		middlewarer.operation = OperationGetRaw
+	}
 
-func (c *GetRawCommand) runExec(session *Session) (*Result, error) {
-	cmd, err := c.builder.Build()
-	if err != nil {
-		return nil, err
+	executed := false
+
+	res, err := runMiddleware(ctx, middlewarer, c.c.runMiddleware, func(ctx context.Context, session *Session) (*Result, error) {
+		executed = true
+		return c.runExec(ctx, session)
+	}, session)
+
+	// The value was returned by a middleware without executing the command, such as by CacheMiddleware
+	if !executed && err == nil && res != nil && !res.NotFound {
+		if err := c.setOutput(res.Value); err != nil {
+			return nil, err
+		}
 	}
 
-	err = session.riak.Execute(cmd)
-	if err != nil {
-		return nil, err
+	return res, err
+}
+
+// setOutput writes value to the output of the command
+func (c *GetRawCommand) setOutput(value []byte) error {
+	if c.isRawOutput {
+		*c.outputBytes = value
+		return nil
 	}
 
-	fetchCmd := cmd.(*riak.FetchValueCommand)
+	return json.Unmarshal(value, c.output)
+}
 
-	if !fetchCmd.Success() {
-		return nil, errors.New("Not successful")
+func (c *GetRawCommand) runExec(ctx context.Context, session *Session) (*Result, error) {
+	err := session.execute(ctx, c.req)
+	if err != nil {
+		return nil, err
 	}
 
-	if fetchCmd.Response.IsNotFound {
-		return &Result{NotFound: true}, errors.New("Not found")
+	if c.req.response.IsNotFound {
+		return &Result{NotFound: true}, ErrNotFound
 	}
 
-	value, context, err := c.fetchValueWithResolver(session, fetchCmd.Response.Values)
+	value, context, err := c.fetchValueWithResolver(ctx, session, c.req.response.Values)
 	if err != nil {
 		return nil, err
 	}
 
-	if c.isRawOutput {
-		*c.outputBytes = value
-	} else {
-		err = json.Unmarshal(value, c.output)
-		if err != nil {
-			return nil, err
-		}
+	err = c.setOutput(value)
+	if err != nil {
+		return nil, err
 	}
 
-	return &Result{
+	res := &Result{
 		Key:     c.key,
 		Context: context,
-	}, nil
+		Value:   value,
+		VClock:  context,
+	}
+
+	if len(c.req.response.Values) > 1 {
+		res.Siblings = len(c.req.response.Values)
+	}
+
+	return res, nil
 }
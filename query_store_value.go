@@ -1,95 +1,102 @@
 package goriak
 
 import (
-	"errors"
-	riak "github.com/basho/riak-go-client"
+	"context"
 )
 
 type SetRawCommand struct {
 	c *Command
 
-	// Riak builder type for SetValue
-	// Other commands populate riakComand directly
-	// SetJSON and SetRaw will populate these values instead
-	storeValueCommandBuilder *riak.StoreValueCommandBuilder
-	storeValueObject         *riak.Object
+	// The request to Riak, populated by SetJSON and SetRaw
+	req *storeValueRequest
 
 	key string
 
+	// isRawInput is true for SetRaw, and false for SetJSON
+	isRawInput bool
+
+	// isConflictWriteBack is true when the command saves the result of a conflict resolver
+	isConflictWriteBack bool
+
 	err error
 }
 
 func (c *SetRawCommand) Key(key string) *SetRawCommand {
-	c.storeValueCommandBuilder.WithKey(key)
+	c.req.key = key
 	c.key = key
 	return c
 }
 
 func (c *SetRawCommand) AddToIndex(key, value string) *SetRawCommand {
-	c.storeValueObject.AddToIndex(key, value)
+	c.req.object.AddToIndex(key, value)
 	return c
 }
 
 // Durable writes (to backend storage)
 func (c *SetRawCommand) WithDw(val uint32) *SetRawCommand {
-	c.storeValueCommandBuilder.WithDw(val)
+	c.req.dw = val
 	return c
 }
 
 // Primary node writes
 func (c *SetRawCommand) WithPw(val uint32) *SetRawCommand {
-	c.storeValueCommandBuilder.WithPw(val)
+	c.req.pw = val
 	return c
 }
 
 // Node writes
 func (c *SetRawCommand) WithW(val uint32) *SetRawCommand {
-	c.storeValueCommandBuilder.WithW(val)
+	c.req.w = val
 	return c
 }
 
 func (c *SetRawCommand) WithContext(val []byte) *SetRawCommand {
-	c.storeValueCommandBuilder.WithVClock(val)
+	c.req.vclock = val
 	return c
 }
 
 // buildStoreValueCommand completes the building if the StoreValueCommand used by SetRaw and SetJSON
 func (c *SetRawCommand) Run(session *Session) (*Result, error) {
+	return c.RunContext(context.Background(), session)
+}
+
+// RunContext is the same as Run, but aborts the command when ctx is cancelled or reaches its deadline
+func (c *SetRawCommand) RunContext(ctx context.Context, session *Session) (*Result, error) {
 	if c.err != nil {
 		return nil, c.err
 	}
 
-	// Set object
-	c.storeValueCommandBuilder.WithContent(c.storeValueObject)
-
-	middlewarer := setRawMiddlewarer{
-		cmd: c,
+	middlewarer := &commandMiddlewarer{
+		key:        c.key,
+		bucket:     c.c.bucket,
+		bucketType: c.c.bucketType,
+		ctx:        ctx,
+		operation:  OperationSetJSON,
+		quorum:     c.req.quorum,
+		size:       len(c.req.object.Value),
+		value:      c.req.object.Value,
+
+		// Riak generates a new key every time a value without a key is saved
+		nonIdempotent: c.key == "",
 	}
 
-	return runMiddleware(middlewarer, c.c.runMiddleware, c.riakExecute, session)
-}
+	if c.isRawInput {
+		middlewarer.operation = OperationSetRaw
+	}
 
-func (c *SetRawCommand) riakExecute(session *Session) (*Result, error) {
+	middlewarer.conflictWriteBack = c.isConflictWriteBack
 
-	// Build it!
-	cmd, err := c.storeValueCommandBuilder.Build()
-	if err != nil {
-		return nil, err
-	}
+	return runMiddleware(ctx, middlewarer, c.c.runMiddleware, c.riakExecute, session)
+}
 
-	err = session.riak.Execute(cmd)
+func (c *SetRawCommand) riakExecute(ctx context.Context, session *Session) (*Result, error) {
+	err := session.execute(ctx, c.req)
 	if err != nil {
 		return nil, err
 	}
 
-	storeCmd := cmd.(*riak.StoreValueCommand)
-
-	if !storeCmd.Success() {
-		return nil, errors.New("Not successful")
-	}
-
 	if c.key == "" {
-		c.key = storeCmd.Response.GeneratedKey
+		c.key = c.req.response.GeneratedKey
 	}
 
 	return &Result{
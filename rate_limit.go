@@ -0,0 +1,154 @@
+package goriak
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimit is the limit of a token bucket. Rate is the number of commands per second, and Burst is
+// the number of commands that can be executed at once. A Rate of 0 disables the limit.
+// Burst defaults to Rate, rounded up.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// RateLimitPolicy configures RateLimitMiddleware. A command has to be allowed by all limits that apply to it.
+type RateLimitPolicy struct {
+	// Global is the limit of all commands
+	Global RateLimit
+
+	// BucketTypes are limits per bucket type
+	BucketTypes map[string]RateLimit
+
+	// Operations are limits per operation, such as a low limit for OperationAllKeys
+	Operations map[Operation]RateLimit
+
+	// Block makes commands wait until they are allowed by the limits. Commands fail with ErrRateLimited
+	// without waiting if the context has a deadline that is before the command would be allowed.
+	// If Block is false, commands that exceed the limit fail directly with ErrRateLimited.
+	Block bool
+}
+
+// RateLimitMiddleware returns a middleware that limits the rate of commands with token buckets
+func RateLimitMiddleware(policy RateLimitPolicy) RunMiddleware {
+	global := newTokenBucket(policy.Global)
+
+	bucketTypes := make(map[string]*tokenBucket)
+	for bucketType, limit := range policy.BucketTypes {
+		bucketTypes[bucketType] = newTokenBucket(limit)
+	}
+
+	operations := make(map[Operation]*tokenBucket)
+	for op, limit := range policy.Operations {
+		operations[op] = newTokenBucket(limit)
+	}
+
+	return func(cmd RunMiddlewarer, next func() (*Result, error)) (*Result, error) {
+		var buckets []*tokenBucket
+
+		for _, b := range []*tokenBucket{global, bucketTypes[cmd.BucketType()], operations[cmd.Operation()]} {
+			if b != nil {
+				buckets = append(buckets, b)
+			}
+		}
+
+		now := time.Now()
+
+		// Take a token from all buckets, and wait for the one with the longest delay
+		var delay time.Duration
+		for _, b := range buckets {
+			if d := b.reserve(now); d > delay {
+				delay = d
+			}
+		}
+
+		cancel := func() {
+			for _, b := range buckets {
+				b.cancel()
+			}
+		}
+
+		if delay == 0 {
+			return next()
+		}
+
+		ctx := cmd.Context()
+
+		if deadline, ok := ctx.Deadline(); !policy.Block || (ok && deadline.Before(now.Add(delay))) {
+			cancel()
+			return nil, ErrRateLimited
+		}
+
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+			return next()
+		case <-ctx.Done():
+			cancel()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// tokenBucket is a token bucket where tokens can be reserved ahead of time.
+// The number of tokens is negative when tokens have been reserved.
+type tokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket returns nil if limit is disabled
+func newTokenBucket(limit RateLimit) *tokenBucket {
+	if limit.Rate <= 0 {
+		return nil
+	}
+
+	burst := float64(limit.Burst)
+	if burst <= 0 {
+		burst = math.Ceil(limit.Rate)
+	}
+
+	return &tokenBucket{
+		rate:   limit.Rate,
+		burst:  burst,
+		tokens: burst,
+	}
+}
+
+// reserve takes a token, and returns the time until the token is available
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.last.IsZero() && now.After(b.last) {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+
+	if now.After(b.last) {
+		b.last = now
+	}
+
+	b.tokens--
+
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// cancel returns a token that was taken by reserve
+func (b *tokenBucket) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens = math.Min(b.burst, b.tokens+1)
+}
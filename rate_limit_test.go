@@ -0,0 +1,167 @@
+package goriak
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRateLimitMiddlewareFailFast(t *testing.T) {
+	limiter := RateLimitMiddleware(RateLimitPolicy{
+		Global: RateLimit{Rate: 1000},
+		Operations: map[Operation]RateLimit{
+			OperationAllKeys: {Rate: 0.1, Burst: 2},
+		},
+	})
+
+	b := Bucket("ratelimit", "default").RegisterRunMiddleware(limiter)
+
+	allKeys := func() error {
+		_, err := b.AllKeys(func([]string) error { return nil }).Run(con())
+		return err
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := allKeys(); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if err := allKeys(); !errors.Is(err, ErrRateLimited) {
+		t.Error("unexpected error:", err)
+	}
+
+	// Other operations have a higher limit
+	for i := 0; i < 10; i++ {
+		if _, err := b.Delete("key").Run(con()); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestRateLimitMiddlewareIndexRange(t *testing.T) {
+	limiter := RateLimitMiddleware(RateLimitPolicy{
+		Operations: map[Operation]RateLimit{
+			OperationKeysInIndexRange: {Rate: 0.1, Burst: 1},
+		},
+	})
+
+	b := Bucket("ratelimit", "default").RegisterRunMiddleware(limiter)
+
+	indexRange := func() error {
+		_, err := b.KeysInIndexRange("$key", "a", "z", func(SecondaryIndexQueryResult) {}).Run(con())
+		return err
+	}
+
+	if err := indexRange(); err != nil {
+		t.Error(err)
+	}
+
+	if err := indexRange(); !errors.Is(err, ErrRateLimited) {
+		t.Error("unexpected error:", err)
+	}
+
+	// Exact match queries are not limited by the range limit
+	for i := 0; i < 3; i++ {
+		if _, err := b.KeysInIndex("$bucket", "ratelimit", func(SecondaryIndexQueryResult) {}).Run(con()); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestRateLimitMiddlewareBlock(t *testing.T) {
+	limiter := RateLimitMiddleware(RateLimitPolicy{
+		BucketTypes: map[string]RateLimit{
+			"default": {Rate: 50, Burst: 1},
+		},
+		Block: true,
+	})
+
+	b := Bucket("ratelimit", "default").RegisterRunMiddleware(limiter)
+
+	start := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if _, err := b.Delete("key").Run(con()); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Two commands waited for 20ms each
+	if elapsed := time.Since(start); elapsed < 35*time.Millisecond {
+		t.Error("commands did not wait:", elapsed)
+	}
+
+	// Other bucket types are not limited
+	start = time.Now()
+
+	for i := 0; i < 3; i++ {
+		if _, err := Bucket("ratelimit", "tests").RegisterRunMiddleware(limiter).Delete("key").Run(con()); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed > 15*time.Millisecond {
+		t.Error("commands waited:", elapsed)
+	}
+}
+
+func TestRateLimitMiddlewareDeadline(t *testing.T) {
+	limiter := RateLimitMiddleware(RateLimitPolicy{
+		Global: RateLimit{Rate: 1, Burst: 1},
+		Block:  true,
+	})
+
+	b := Bucket("ratelimit", "default").RegisterRunMiddleware(limiter)
+
+	if _, err := b.Delete("key").Run(con()); err != nil {
+		t.Error(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// Fails without waiting, as the next token is available after the deadline
+	start := time.Now()
+
+	if _, err := b.Delete("key").RunContext(ctx, con()); !errors.Is(err, ErrRateLimited) {
+		t.Error("unexpected error:", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Error("command waited:", elapsed)
+	}
+
+	// Cancelled while waiting
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	if _, err := b.Delete("key").RunContext(ctx, con()); err != context.Canceled {
+		t.Error("unexpected error:", err)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	b := newTokenBucket(RateLimit{Rate: 10, Burst: 2})
+	now := time.Now()
+
+	if b.reserve(now) != 0 || b.reserve(now) != 0 {
+		t.Error("burst was not allowed")
+	}
+
+	if d := b.reserve(now); d != 100*time.Millisecond {
+		t.Error("unexpected delay:", d)
+	}
+
+	b.cancel()
+
+	// Refilled after 100ms
+	if d := b.reserve(now.Add(100 * time.Millisecond)); d != 0 {
+		t.Error("unexpected delay:", d)
+	}
+
+	if newTokenBucket(RateLimit{}) != nil {
+		t.Error("disabled limit created a bucket")
+	}
+}
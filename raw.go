@@ -12,14 +12,14 @@ func (c *Command) SetRaw(value []byte) *SetRawCommand {
 		Value: value,
 	}
 
-	builder := riak.NewStoreValueCommandBuilder().
-		WithBucket(c.bucket).
-		WithBucketType(c.bucketType)
-
 	return &SetRawCommand{
-		c:                        c,
-		storeValueObject:         object,
-		storeValueCommandBuilder: builder,
+		c:          c,
+		isRawInput: true,
+		req: &storeValueRequest{
+			bucket:     c.bucket,
+			bucketType: c.bucketType,
+			object:     object,
+		},
 	}
 }
 
@@ -37,10 +37,11 @@ func (c *Command) GetRaw(key string, output *[]byte) *GetRawCommand {
 		isRawOutput: true,
 	}
 
-	cmd.builder = riak.NewFetchValueCommandBuilder().
-		WithBucket(c.bucket).
-		WithBucketType(c.bucketType).
-		WithKey(key)
+	cmd.req = &fetchValueRequest{
+		bucket:     c.bucket,
+		bucketType: c.bucketType,
+		key:        key,
+	}
 
 	return cmd
 }
@@ -1,8 +1,8 @@
 package goriak
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 
 	riak "github.com/basho/riak-go-client"
 )
@@ -36,17 +36,22 @@ func (r *Register) SetString(val string) *Register {
 }
 
 func (r *Register) Exec(client *Session) error {
+	return r.ExecContext(context.Background(), client)
+}
+
+// ExecContext is the same as Exec, but aborts the request when ctx is cancelled or reaches its deadline
+func (r *Register) ExecContext(ctx context.Context, client *Session) error {
 	if r == nil {
-		return errors.New("Nil Register")
+		return uninitializedError("Nil Register")
 	}
 
 	if r.name == "" {
-		return errors.New("Unknown path to Register. Retrieve Register with Get or Set before updating the Register")
+		return uninitializedError("Unknown path to Register. Retrieve Register with Get or Set before updating the Register")
 	}
 
 	// Validate s.key
 	if r.key.bucket == "" || r.key.bucketType == "" || r.key.key == "" {
-		return errors.New("Invalid key in Register Exec()")
+		return uninitializedError("Invalid key in Register Exec()")
 	}
 
 	op := &riak.MapOperation{}
@@ -59,34 +64,20 @@ func (r *Register) Exec(client *Session) error {
 
 	op.SetRegister(r.name, r.val)
 
-	cmd, err := riak.NewUpdateMapCommandBuilder().
-		WithBucket(r.key.bucket).
-		WithBucketType(r.key.bucketType).
-		WithKey(r.key.key).
-		WithMapOperation(outerOp).
-		WithContext(r.context).
-		Build()
-
-	if err != nil {
-		return err
+	req := &updateMapRequest{
+		bucket:     r.key.bucket,
+		bucketType: r.key.bucketType,
+		key:        r.key.key,
+		op:         outerOp,
+		context:    r.context,
 	}
 
-	err = client.riak.Execute(cmd)
+	err := r.execute(ctx, client, req)
 
 	if err != nil {
 		return err
 	}
 
-	res, ok := cmd.(*riak.UpdateMapCommand)
-
-	if !ok {
-		return errors.New("Could not convert")
-	}
-
-	if !res.Success() {
-		return errors.New("Not successful")
-	}
-
 	return nil
 }
 
@@ -0,0 +1,463 @@
+package goriak
+
+import (
+	"reflect"
+
+	riak "github.com/basho/riak-go-client"
+)
+
+// request is a single request to Riak, such as fetching or storing a value.
+//
+// The Riak backend builds and executes the equivalent command from riak-go-client,
+// other backends (such as the in-memory backend) uses the request values directly.
+// The result of the request is written to the response field of the request.
+type request interface {
+	// build creates the riak-go-client command for this request
+	build() (riak.Command, error)
+
+	// read saves the response from an executed riak-go-client command
+	read(cmd riak.Command) error
+}
+
+// quorum holds the consistency options that are supported by a request.
+// A value of 0 means that the default value of the bucket type is used.
+type quorum struct {
+	r  uint32
+	pr uint32
+	w  uint32
+	pw uint32
+	dw uint32
+}
+
+type fetchValueRequest struct {
+	bucket     string
+	bucketType string
+	key        string
+	quorum
+
+	response *riak.FetchValueResponse
+}
+
+func (r *fetchValueRequest) build() (riak.Command, error) {
+	builder := riak.NewFetchValueCommandBuilder().
+		WithBucket(r.bucket).
+		WithBucketType(r.bucketType).
+		WithKey(r.key)
+
+	if r.r > 0 {
+		builder.WithR(r.r)
+	}
+
+	if r.pr > 0 {
+		builder.WithPr(r.pr)
+	}
+
+	return builder.Build()
+}
+
+func (r *fetchValueRequest) read(cmd riak.Command) error {
+	res := cmd.(*riak.FetchValueCommand)
+
+	if !res.Success() {
+		return ErrNotSuccessful
+	}
+
+	r.response = res.Response
+	return nil
+}
+
+type storeValueRequest struct {
+	bucket     string
+	bucketType string
+	key        string
+	vclock     []byte
+	object     *riak.Object
+	quorum
+
+	response *riak.StoreValueResponse
+}
+
+func (r *storeValueRequest) build() (riak.Command, error) {
+	builder := riak.NewStoreValueCommandBuilder().
+		WithBucket(r.bucket).
+		WithBucketType(r.bucketType).
+		WithContent(r.object)
+
+	if r.key != "" {
+		builder.WithKey(r.key)
+	}
+
+	if len(r.vclock) > 0 {
+		builder.WithVClock(r.vclock)
+	}
+
+	if r.w > 0 {
+		builder.WithW(r.w)
+	}
+
+	if r.pw > 0 {
+		builder.WithPw(r.pw)
+	}
+
+	if r.dw > 0 {
+		builder.WithDw(r.dw)
+	}
+
+	return builder.Build()
+}
+
+func (r *storeValueRequest) read(cmd riak.Command) error {
+	res := cmd.(*riak.StoreValueCommand)
+
+	if !res.Success() {
+		return ErrNotSuccessful
+	}
+
+	r.response = res.Response
+	return nil
+}
+
+type deleteValueRequest struct {
+	bucket     string
+	bucketType string
+	key        string
+	quorum
+}
+
+func (r *deleteValueRequest) build() (riak.Command, error) {
+	builder := riak.NewDeleteValueCommandBuilder().
+		WithBucket(r.bucket).
+		WithBucketType(r.bucketType).
+		WithKey(r.key)
+
+	if r.r > 0 {
+		builder.WithR(r.r)
+	}
+
+	if r.pr > 0 {
+		builder.WithPr(r.pr)
+	}
+
+	if r.w > 0 {
+		builder.WithW(r.w)
+	}
+
+	if r.pw > 0 {
+		builder.WithPw(r.pw)
+	}
+
+	if r.dw > 0 {
+		builder.WithDw(r.dw)
+	}
+
+	return builder.Build()
+}
+
+func (r *deleteValueRequest) read(cmd riak.Command) error {
+	if !cmd.Success() {
+		return ErrNotSuccessful
+	}
+
+	return nil
+}
+
+type listKeysRequest struct {
+	bucket     string
+	bucketType string
+	callback   func([]string) error
+}
+
+func (r *listKeysRequest) build() (riak.Command, error) {
+	return riak.NewListKeysCommandBuilder().
+		WithBucket(r.bucket).
+		WithBucketType(r.bucketType).
+		WithCallback(r.callback).
+		WithAllowListing(). // Required as of github.com/basho/riak-go-client 1.9.0
+		WithStreaming(true).
+		Build()
+}
+
+func (r *listKeysRequest) read(cmd riak.Command) error {
+	if !cmd.Success() {
+		return ErrNotSuccessful
+	}
+
+	return nil
+}
+
+type secondaryIndexRequest struct {
+	bucket     string
+	bucketType string
+	indexName  string
+
+	// Exact match on indexKey, or a range query between rangeMin and rangeMax
+	indexKey string
+	isRange  bool
+	rangeMin string
+	rangeMax string
+
+	maxResults   uint32
+	continuation []byte
+	callback     func([]*riak.SecondaryIndexQueryResult) error
+
+	response *riak.SecondaryIndexQueryResponse
+}
+
+func (r *secondaryIndexRequest) build() (riak.Command, error) {
+	builder := riak.NewSecondaryIndexQueryCommandBuilder().
+		WithBucket(r.bucket).
+		WithBucketType(r.bucketType).
+		WithIndexName(r.indexName).
+		WithStreaming(true).
+		WithCallback(r.callback)
+
+	if r.isRange {
+		builder.WithRange(r.rangeMin, r.rangeMax)
+	} else {
+		builder.WithIndexKey(r.indexKey)
+	}
+
+	if r.maxResults > 0 {
+		builder.WithMaxResults(r.maxResults)
+	}
+
+	if len(r.continuation) > 0 {
+		builder.WithContinuation(r.continuation)
+	}
+
+	return builder.Build()
+}
+
+func (r *secondaryIndexRequest) read(cmd riak.Command) error {
+	res := cmd.(*riak.SecondaryIndexQueryCommand)
+
+	if !res.Success() {
+		return ErrNotSuccessful
+	}
+
+	r.response = res.Response
+	return nil
+}
+
+type fetchMapRequest struct {
+	bucket     string
+	bucketType string
+	key        string
+	quorum
+
+	response *riak.FetchMapResponse
+}
+
+func (r *fetchMapRequest) build() (riak.Command, error) {
+	builder := riak.NewFetchMapCommandBuilder().
+		WithBucket(r.bucket).
+		WithBucketType(r.bucketType).
+		WithKey(r.key)
+
+	if r.r > 0 {
+		builder.WithR(r.r)
+	}
+
+	if r.pr > 0 {
+		builder.WithPr(r.pr)
+	}
+
+	return builder.Build()
+}
+
+func (r *fetchMapRequest) read(cmd riak.Command) error {
+	res := cmd.(*riak.FetchMapCommand)
+
+	if !res.Success() {
+		return ErrNotSuccessful
+	}
+
+	r.response = res.Response
+	return nil
+}
+
+type updateMapRequest struct {
+	bucket     string
+	bucketType string
+	key        string
+	context    []byte
+	op         *riak.MapOperation
+	returnBody bool
+	quorum
+
+	response *riak.UpdateMapResponse
+}
+
+func (r *updateMapRequest) build() (riak.Command, error) {
+	builder := riak.NewUpdateMapCommandBuilder().
+		WithBucket(r.bucket).
+		WithBucketType(r.bucketType).
+		WithMapOperation(r.op).
+		WithReturnBody(r.returnBody)
+
+	if r.key != "" {
+		builder.WithKey(r.key)
+	}
+
+	if len(r.context) > 0 {
+		builder.WithContext(r.context)
+	}
+
+	if r.w > 0 {
+		builder.WithW(r.w)
+	}
+
+	if r.pw > 0 {
+		builder.WithPw(r.pw)
+	}
+
+	if r.dw > 0 {
+		builder.WithDw(r.dw)
+	}
+
+	return builder.Build()
+}
+
+func (r *updateMapRequest) read(cmd riak.Command) error {
+	res, ok := cmd.(*riak.UpdateMapCommand)
+
+	if !ok {
+		return unexpectedCommandError(cmd)
+	}
+
+	if !res.Success() {
+		return ErrNotSuccessful
+	}
+
+	r.response = res.Response
+	return nil
+}
+
+type fetchHllRequest struct {
+	bucket     string
+	bucketType string
+	key        string
+	quorum
+
+	response *riak.FetchHllResponse
+}
+
+func (r *fetchHllRequest) build() (riak.Command, error) {
+	builder := riak.NewFetchHllCommandBuilder().
+		WithBucket(r.bucket).
+		WithBucketType(r.bucketType).
+		WithKey(r.key)
+
+	if r.r > 0 {
+		builder.WithR(r.r)
+	}
+
+	if r.pr > 0 {
+		builder.WithPr(r.pr)
+	}
+
+	return builder.Build()
+}
+
+func (r *fetchHllRequest) read(cmd riak.Command) error {
+	res, ok := cmd.(*riak.FetchHllCommand)
+	if !ok {
+		return unexpectedCommandError(cmd)
+	}
+
+	if !res.Success() {
+		return ErrNotSuccessful
+	}
+
+	r.response = res.Response
+	return nil
+}
+
+type updateHllRequest struct {
+	bucket     string
+	bucketType string
+	key        string
+	additions  [][]byte
+	returnBody bool
+	quorum
+
+	response *riak.UpdateHllResponse
+}
+
+func (r *updateHllRequest) build() (riak.Command, error) {
+	builder := riak.NewUpdateHllCommandBuilder().
+		WithBucket(r.bucket).
+		WithBucketType(r.bucketType).
+		WithAdditions(r.additions...).
+		WithReturnBody(r.returnBody)
+
+	if r.key != "" {
+		builder.WithKey(r.key)
+	}
+
+	if r.w > 0 {
+		builder.WithW(r.w)
+	}
+
+	if r.pw > 0 {
+		builder.WithPw(r.pw)
+	}
+
+	if r.dw > 0 {
+		builder.WithDw(r.dw)
+	}
+
+	return builder.Build()
+}
+
+func (r *updateHllRequest) read(cmd riak.Command) error {
+	res, ok := cmd.(*riak.UpdateHllCommand)
+	if !ok {
+		return unexpectedCommandError(cmd)
+	}
+
+	if !res.Success() {
+		return ErrNotSuccessful
+	}
+
+	r.response = res.Response
+	return nil
+}
+
+type pingRequest struct{}
+
+func (r *pingRequest) build() (riak.Command, error) {
+	return (&riak.PingCommandBuilder{}).Build()
+}
+
+func (r *pingRequest) read(cmd riak.Command) error {
+	if !cmd.Success() {
+		return ErrNotSuccessful
+	}
+
+	return nil
+}
+
+type serverInfoRequest struct {
+	response *riak.GetServerInfoResponse
+}
+
+func (r *serverInfoRequest) build() (riak.Command, error) {
+	return &riak.GetServerInfoCommand{}, nil
+}
+
+func (r *serverInfoRequest) read(cmd riak.Command) error {
+	res := cmd.(*riak.GetServerInfoCommand)
+
+	if !res.Success() {
+		return ErrNotSuccessful
+	}
+
+	r.response = res.Response
+	return nil
+}
+
+// unexpectedCommandError is returned by read when cmd is not the command that was built by the request
+func unexpectedCommandError(cmd riak.Command) error {
+	return newUnsupportedTypeError(nil, reflect.TypeOf(cmd), "Could not convert result: "+reflect.TypeOf(cmd).String())
+}
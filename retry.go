@@ -0,0 +1,178 @@
+package goriak
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	riak "github.com/basho/riak-go-client"
+)
+
+// RetryPolicy configures RetryMiddleware
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times that a command is executed, including the first attempt.
+	// Defaults to 3.
+	MaxAttempts int
+
+	// InitialBackoff is the time to wait before the first retry. Defaults to 50ms.
+	InitialBackoff time.Duration
+
+	// MaxBackoff is the maximum time to wait between two attempts. Defaults to 2s.
+	MaxBackoff time.Duration
+
+	// Multiplier is the factor that the backoff is multiplied with after every attempt. Defaults to 2.
+	Multiplier float64
+
+	// Retryable decides if a failed command should be retried. Defaults to IsTransient.
+	Retryable func(error) bool
+
+	// SkipOperations are operations that are never retried, in addition to AllKeys, KeysInIndex and KeysInIndexRange
+	SkipOperations []Operation
+
+	// RetryNonIdempotent allows retries of commands that are not idempotent, such as counter
+	// increments, HyperLogLog additions and values saved without a key. A retry of a command that was
+	// executed by Riak, but failed to respond, applies the change twice.
+	RetryNonIdempotent bool
+}
+
+type noRetryKey struct{}
+
+// WithoutRetry returns a context that disables RetryMiddleware for commands executed with RunContext(ctx, ...)
+func WithoutRetry(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noRetryKey{}, true)
+}
+
+// RetryMiddleware returns a middleware that retries commands that failed with a transient error.
+//
+// The time between two attempts is increased exponentially from InitialBackoff to MaxBackoff, and
+// a random jitter of up to half of the backoff is subtracted so that clients do not retry in lockstep.
+// Retries are aborted when the context of the command is done.
+//
+// Commands that are not idempotent (RunMiddlewarer.Idempotent) are not retried unless RetryNonIdempotent is set.
+// AllKeys, KeysInIndex and KeysInIndexRange are never retried, as keys that were streamed to the callback before the error
+// would be sent again.
+func RetryMiddleware(policy RetryPolicy) RunMiddleware {
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = 3
+	}
+
+	if policy.InitialBackoff <= 0 {
+		policy.InitialBackoff = 50 * time.Millisecond
+	}
+
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = 2 * time.Second
+	}
+
+	if policy.Multiplier < 1 {
+		policy.Multiplier = 2
+	}
+
+	if policy.Retryable == nil {
+		policy.Retryable = IsTransient
+	}
+
+	// Streaming operations can not be retried without sending keys to the callback twice
+	skip := map[Operation]bool{
+		OperationAllKeys:          true,
+		OperationKeysInIndex:      true,
+		OperationKeysInIndexRange: true,
+	}
+
+	for _, op := range policy.SkipOperations {
+		skip[op] = true
+	}
+
+	return func(cmd RunMiddlewarer, next func() (*Result, error)) (*Result, error) {
+		ctx := cmd.Context()
+
+		if skip[cmd.Operation()] || ctx.Value(noRetryKey{}) != nil || (!cmd.Idempotent() && !policy.RetryNonIdempotent) {
+			return next()
+		}
+
+		for attempt := 1; ; attempt++ {
+			res, err := next()
+			if err == nil || attempt >= policy.MaxAttempts || !policy.Retryable(err) {
+				return res, err
+			}
+
+			timer := time.NewTimer(policy.backoff(attempt))
+
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return res, err
+			}
+		}
+	}
+}
+
+// backoff returns the time to wait after attempt number attempt
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	backoff := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(attempt-1))
+	if backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+
+	// Jitter, between backoff/2 and backoff
+	return time.Duration(backoff/2 + rand.Float64()*backoff/2)
+}
+
+// transientRiakErrors are parts of error messages from Riak that are caused by temporary conditions
+var transientRiakErrors = []string{
+	"overload",
+	"timeout",
+	"insufficient_vnodes",
+	"all_nodes_down",
+}
+
+// IsTransient returns true if err is caused by a condition that is likely to be temporary, such as a
+// timeout, an unavailable node, or an overloaded Riak node. Errors from a cancelled context are not transient.
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrSessionClosed) {
+		return false
+	}
+
+	var riakErr *RiakError
+	if errors.As(err, &riakErr) {
+		for _, msg := range transientRiakErrors {
+			if strings.Contains(riakErr.Message, msg) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	// riak-go-client wraps errors in ClientError, which does not support errors.Unwrap
+	for inner := err; inner != nil; {
+		var netErr net.Error
+		if errors.As(inner, &netErr) {
+			return true
+		}
+
+		if inner == riak.ErrCannotRead || inner == riak.ErrCannotWrite {
+			return true
+		}
+
+		clientErr, ok := inner.(riak.ClientError)
+		if !ok {
+			return false
+		}
+
+		if clientErr.Errmsg == riak.ErrClusterNoNodesAvailable ||
+			strings.Contains(clientErr.Errmsg, "all connections in use") ||
+			strings.Contains(strings.ToLower(clientErr.Errmsg), "timeout") {
+			return true
+		}
+
+		inner = clientErr.InnerError
+	}
+
+	return false
+}
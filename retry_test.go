@@ -0,0 +1,383 @@
+package goriak
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	riak "github.com/basho/riak-go-client"
+)
+
+// failingMiddleware fails the first n attempts with err
+func failingMiddleware(n int, err error, attempts *int) RunMiddleware {
+	return func(cmd RunMiddlewarer, next func() (*Result, error)) (*Result, error) {
+		*attempts++
+
+		if *attempts <= n {
+			return nil, err
+		}
+
+		return next()
+	}
+}
+
+// riakTestError returns err as it is returned when Riak responds with an error
+func riakTestError(msg string) error {
+	return newRiakError(riak.RiakError{Errmsg: msg}, "")
+}
+
+func testRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+	}
+}
+
+func TestRetryMiddleware(t *testing.T) {
+	attempts := 0
+
+	_, err := Bucket("retry", "default").
+		RegisterRunMiddleware(RetryMiddleware(testRetryPolicy())).
+		RegisterRunMiddleware(failingMiddleware(2, riakTestError("overload"), &attempts)).
+		SetRaw([]byte("a")).
+		Key(randomKey()).
+		Run(con())
+	if err != nil {
+		t.Error(err)
+	}
+
+	if attempts != 3 {
+		t.Error("unexpected attempts:", attempts)
+	}
+
+	// Gives up after MaxAttempts
+	attempts = 0
+
+	_, err = Bucket("retry", "default").
+		RegisterRunMiddleware(RetryMiddleware(testRetryPolicy())).
+		RegisterRunMiddleware(failingMiddleware(5, riakTestError("overload"), &attempts)).
+		SetRaw([]byte("a")).
+		Key(randomKey()).
+		Run(con())
+	if err == nil || !strings.Contains(err.Error(), "overload") {
+		t.Error("unexpected error:", err)
+	}
+
+	if attempts != 3 {
+		t.Error("unexpected attempts:", attempts)
+	}
+
+	// Permanent errors are not retried
+	attempts = 0
+
+	_, err = Bucket("retry", "default").
+		RegisterRunMiddleware(RetryMiddleware(testRetryPolicy())).
+		RegisterRunMiddleware(failingMiddleware(1, errors.New("permanent"), &attempts)).
+		SetRaw([]byte("a")).
+		Key(randomKey()).
+		Run(con())
+	if err == nil || err.Error() != "permanent" {
+		t.Error("unexpected error:", err)
+	}
+
+	if attempts != 1 {
+		t.Error("unexpected attempts:", attempts)
+	}
+}
+
+func TestRetryMiddlewareOptOut(t *testing.T) {
+	policy := testRetryPolicy()
+	policy.SkipOperations = []Operation{OperationDelete}
+
+	attempts := 0
+
+	Bucket("retry", "default").
+		RegisterRunMiddleware(RetryMiddleware(policy)).
+		RegisterRunMiddleware(failingMiddleware(1, riakTestError("timeout"), &attempts)).
+		Delete(randomKey()).
+		Run(con())
+
+	if attempts != 1 {
+		t.Error("unexpected attempts:", attempts)
+	}
+
+	attempts = 0
+
+	Bucket("retry", "default").
+		RegisterRunMiddleware(RetryMiddleware(testRetryPolicy())).
+		RegisterRunMiddleware(failingMiddleware(1, riakTestError("timeout"), &attempts)).
+		SetRaw([]byte("a")).
+		RunContext(WithoutRetry(context.Background()), con())
+
+	if attempts != 1 {
+		t.Error("unexpected attempts:", attempts)
+	}
+}
+
+func TestRetryMiddlewareNonIdempotent(t *testing.T) {
+	type testType struct {
+		Counter *Counter
+	}
+
+	for _, allow := range []bool{false, true} {
+		policy := testRetryPolicy()
+		policy.RetryNonIdempotent = allow
+
+		attempts := 0
+		fail := false
+
+		m := func(cmd RunMiddlewarer, next func() (*Result, error)) (*Result, error) {
+			if fail {
+				attempts++
+
+				if attempts == 1 {
+					return nil, riakTestError("overload")
+				}
+			}
+
+			return next()
+		}
+
+		expected := 1
+		if allow {
+			expected = 2
+		}
+
+		key := randomKey()
+		b := Bucket("retry", "maps").
+			RegisterRunMiddleware(RetryMiddleware(policy)).
+			RegisterRunMiddleware(m)
+
+		_, err := b.Set(testType{Counter: NewCounter()}).Key(key).Run(con())
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		var res testType
+
+		_, err = b.Get(key, &res).Run(con())
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		fail = true
+
+		res.Counter.Increase(1).Exec(con())
+
+		if attempts != expected {
+			t.Errorf("allow=%v: unexpected counter attempts: %d", allow, attempts)
+		}
+
+		attempts = 0
+
+		b.UpdateHyperLogLog().Key(key).Add([]byte("a")).Run(con())
+
+		if attempts != expected {
+			t.Errorf("allow=%v: unexpected hll attempts: %d", allow, attempts)
+		}
+	}
+}
+
+func TestRetryMiddlewareUnkeyed(t *testing.T) {
+	type testType struct {
+		Name string
+	}
+
+	attempts := 0
+
+	// Fails after the value has been saved
+	m := func(cmd RunMiddlewarer, next func() (*Result, error)) (*Result, error) {
+		attempts++
+
+		res, err := next()
+		if attempts == 1 {
+			return res, riakTestError("timeout")
+		}
+
+		return res, err
+	}
+
+	b := Bucket("retry", "unkeyed").
+		RegisterRunMiddleware(RetryMiddleware(testRetryPolicy())).
+		RegisterRunMiddleware(m)
+
+	commands := map[string]func(key string) error{
+		"SetRaw": func(key string) error {
+			_, err := b.SetRaw([]byte("a")).Key(key).Run(con())
+			return err
+		},
+		"SetJSON": func(key string) error {
+			_, err := b.SetJSON("a").Key(key).Run(con())
+			return err
+		},
+		"Set": func(key string) error {
+			_, err := Bucket("retry", "maps").
+				RegisterRunMiddleware(RetryMiddleware(testRetryPolicy())).
+				RegisterRunMiddleware(m).
+				Set(testType{Name: "a"}).Key(key).Run(con())
+			return err
+		},
+	}
+
+	for name, run := range commands {
+		// A new key is generated by Riak for every attempt, the value would be saved twice
+		attempts = 0
+
+		if err := run(""); err == nil || attempts != 1 {
+			t.Errorf("%s: unexpected result after %d attempts: %v", name, attempts, err)
+		}
+
+		// Values with a key are retried
+		attempts = 0
+
+		if err := run(randomKey()); err != nil || attempts != 2 {
+			t.Errorf("%s: unexpected result after %d attempts: %v", name, attempts, err)
+		}
+	}
+}
+
+func TestRetryMiddlewareStreams(t *testing.T) {
+	key := randomKey()
+
+	_, err := Bucket("retry", "streams").SetRaw([]byte("a")).Key(key).Run(con())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Fails after the keys have been streamed to the callback
+	attempts := 0
+	m := func(cmd RunMiddlewarer, next func() (*Result, error)) (*Result, error) {
+		attempts++
+
+		res, err := next()
+		if attempts == 1 {
+			return res, riakTestError("timeout")
+		}
+
+		return res, err
+	}
+
+	var keys []string
+
+	_, err = Bucket("retry", "streams").
+		RegisterRunMiddleware(RetryMiddleware(testRetryPolicy())).
+		RegisterRunMiddleware(m).
+		AllKeys(func(k []string) error {
+			keys = append(keys, k...)
+			return nil
+		}).
+		Run(con())
+	if err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Error("unexpected error:", err)
+	}
+
+	if attempts != 1 || len(keys) != 1 || keys[0] != key {
+		t.Errorf("unexpected keys after %d attempts: %v", attempts, keys)
+	}
+
+	// KeysInIndex
+	attempts = 0
+	keys = nil
+
+	Bucket("retry", "streams").
+		RegisterRunMiddleware(RetryMiddleware(testRetryPolicy())).
+		RegisterRunMiddleware(m).
+		KeysInIndex("$bucket", "retry", func(res SecondaryIndexQueryResult) {
+			if !res.IsComplete {
+				keys = append(keys, res.Key)
+			}
+		}).
+		Run(con())
+
+	if attempts != 1 || len(keys) != 1 || keys[0] != key {
+		t.Errorf("unexpected index keys after %d attempts: %v", attempts, keys)
+	}
+	// KeysInIndexRange
+	attempts = 0
+	keys = nil
+
+	Bucket("retry", "streams").
+		RegisterRunMiddleware(RetryMiddleware(testRetryPolicy())).
+		RegisterRunMiddleware(m).
+		KeysInIndexRange("$key", key, key, func(res SecondaryIndexQueryResult) {
+			if !res.IsComplete {
+				keys = append(keys, res.Key)
+			}
+		}).
+		Run(con())
+
+	if attempts != 1 || len(keys) != 1 || keys[0] != key {
+		t.Errorf("unexpected index range keys after %d attempts: %v", attempts, keys)
+	}
+}
+
+func TestRetryMiddlewareContext(t *testing.T) {
+	policy := testRetryPolicy()
+	policy.MaxAttempts = 10
+	policy.InitialBackoff = time.Hour
+	policy.MaxBackoff = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	attempts := 0
+
+	_, err := Bucket("retry", "default").
+		RegisterRunMiddleware(RetryMiddleware(policy)).
+		RegisterRunMiddleware(failingMiddleware(5, riakTestError("overload"), &attempts)).
+		SetRaw([]byte("a")).
+		RunContext(ctx, con())
+	if err == nil || attempts != 1 {
+		t.Error("unexpected result:", err, attempts)
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Multiplier:     2,
+	}
+
+	for attempt, max := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		backoff := p.backoff(attempt + 1)
+
+		if backoff < max/2 || backoff > max {
+			t.Errorf("attempt %d: unexpected backoff %s", attempt+1, backoff)
+		}
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		err       error
+		transient bool
+	}{
+		{riakTestError("overload"), true},
+		{riakTestError("{insufficient_vnodes,1,need,2}"), true},
+		{riakTestError("notfound"), false},
+		{riak.ClientError{Errmsg: riak.ErrClusterNoNodesAvailable}, true},
+		{riak.ErrConnMgrAllConnectionsInUse, true},
+		{riak.ClientError{Errmsg: "wrapped", InnerError: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}, true},
+		{riak.ErrCannotRead, true},
+		{riak.ErrKeyRequired, false},
+		{context.Canceled, false},
+		{context.DeadlineExceeded, false},
+		{ErrSessionClosed, false},
+		{ErrNotFound, false},
+		{nil, false},
+	}
+
+	for _, test := range tests {
+		if IsTransient(test.err) != test.transient {
+			t.Errorf("%v: expected %v", test.err, test.transient)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package goriak
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ServerInfo is the node name and the version of Riak, as reported by a Riak node
+type ServerInfo struct {
+	Node    string // Such as "riak@127.0.0.1"
+	Version string // Such as "2.2.3"
+}
+
+// AtLeast returns true if Version is major.minor or later.
+// False is returned if Version could not be parsed.
+func (s ServerInfo) AtLeast(major, minor int) bool {
+	parts := strings.SplitN(s.Version, ".", 3)
+	if len(parts) < 2 {
+		return false
+	}
+
+	serverMajor, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return false
+	}
+
+	// Ignore suffixes, such as in "2.1p1"
+	minorDigits := parts[1]
+	if i := strings.IndexFunc(minorDigits, func(r rune) bool { return r < '0' || r > '9' }); i >= 0 {
+		minorDigits = minorDigits[:i]
+	}
+
+	serverMinor, err := strconv.Atoi(minorDigits)
+	if err != nil {
+		return false
+	}
+
+	if serverMajor != major {
+		return serverMajor > major
+	}
+
+	return serverMinor >= minor
+}
+
+// NodeServerInfo is the ServerInfo of a single node, see Session.NodesServerInfo
+type NodeServerInfo struct {
+	Address    string
+	ServerInfo ServerInfo
+
+	// Err is set if ServerInfo could not be retrieved from the node
+	Err error
+}
+
+// ServerInfo returns the node name and Riak version of one of the nodes in the cluster
+func (c *Session) ServerInfo(ctx context.Context) (ServerInfo, error) {
+	req := &serverInfoRequest{}
+
+	err := c.execute(ctx, req)
+	if err != nil {
+		return ServerInfo{}, err
+	}
+
+	return ServerInfo{
+		Node:    req.response.Node,
+		Version: req.response.ServerVersion,
+	}, nil
+}
+
+// NodesServerInfo returns the ServerInfo of each node in the Session.
+// The request is sent to every node with the connections of that node, and nodes that are unavailable return an error.
+func (c *Session) NodesServerInfo(ctx context.Context) []NodeServerInfo {
+	nodes := c.backend.health()
+
+	res := make([]NodeServerInfo, len(nodes))
+
+	for i, node := range nodes {
+		req := &serverInfoRequest{}
+
+		res[i].Address = node.Address
+		res[i].Err = c.executeOnNode(ctx, node.Address, req)
+
+		if res[i].Err == nil {
+			res[i].ServerInfo = ServerInfo{
+				Node:    req.response.Node,
+				Version: req.response.ServerVersion,
+			}
+		}
+	}
+
+	return res
+}
+
+// checkServerVersion returns an error if any node could not be reached, or if a node is running Riak older than 2.0
+func (c *Session) checkServerVersion(ctx context.Context) error {
+	for _, node := range c.NodesServerInfo(ctx) {
+		if node.Err != nil {
+			return fmt.Errorf("goriak: could not get the Riak version of %s: %w", node.Address, node.Err)
+		}
+
+		if !node.ServerInfo.AtLeast(2, 0) {
+			return fmt.Errorf("%w: %s is running %s", ErrUnsupportedServerVersion, node.Address, node.ServerInfo.Version)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package goriak
+
+import (
+	"context"
+	"testing"
+)
+
+func TestServerInfo(t *testing.T) {
+	info, err := con().ServerInfo(context.Background())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if info.Node == "" || !info.AtLeast(2, 0) {
+		t.Errorf("unexpected server info: %+v", info)
+	}
+}
+
+func TestNodesServerInfo(t *testing.T) {
+	nodes := con().NodesServerInfo(context.Background())
+
+	if len(nodes) != 1 {
+		t.Errorf("unexpected nodes: %+v", nodes)
+		return
+	}
+
+	if nodes[0].Err != nil || nodes[0].ServerInfo.Version == "" {
+		t.Errorf("unexpected server info: %+v", nodes[0])
+	}
+}
+
+func TestConnectCheckServerVersion(t *testing.T) {
+	c, err := Connect(ConnectOpts{
+		Addresses:          []string{"127.0.0.1"},
+		CheckServerVersion: true,
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	c.Close()
+}
+
+func TestServerInfoAtLeast(t *testing.T) {
+	tests := []struct {
+		version string
+		major   int
+		minor   int
+		res     bool
+	}{
+		{"2.0.0", 2, 0, true},
+		{"2.2.3", 2, 0, true},
+		{"2.1p1", 2, 1, true},
+		{"3.0.1", 2, 2, true},
+		{"1.4.12", 2, 0, false},
+		{"2.0.0", 2, 1, false},
+		{"", 2, 0, false},
+		{"riak", 2, 0, false},
+	}
+
+	for _, test := range tests {
+		if res := (ServerInfo{Version: test.version}).AtLeast(test.major, test.minor); res != test.res {
+			t.Errorf("%s AtLeast(%d, %d): %v", test.version, test.major, test.minor, res)
+		}
+	}
+}
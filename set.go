@@ -2,8 +2,9 @@ package goriak
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
+	"reflect"
 
 	riak "github.com/basho/riak-go-client"
 )
@@ -15,6 +16,35 @@ type helper struct {
 	context []byte      // riak context
 }
 
+// execute runs req with the middleware from the command that created the helper
+func (h *helper) execute(ctx context.Context, session *Session, req *updateMapRequest) error {
+	middlewarer := &commandMiddlewarer{
+		key:        h.key.key,
+		bucket:     h.key.bucket,
+		bucketType: h.key.bucketType,
+		ctx:        ctx,
+		operation:  OperationMapOperation,
+		quorum:     req.quorum,
+		size:       mapOperationSize(reflect.ValueOf(req.op)),
+
+		nonIdempotent: mapOperationIncrements(reflect.ValueOf(req.op)),
+	}
+
+	_, err := runMiddleware(ctx, middlewarer, h.key.runMiddleware, func(ctx context.Context, session *Session) (*Result, error) {
+		err := session.execute(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+
+		return &Result{
+			Key:     h.key.key,
+			Context: req.response.Context,
+		}, nil
+	}, session)
+
+	return err
+}
+
 // NewSet returnes a new and empty Set.
 // Sets returned from NewSet() can not be used with Set.Exec()
 func NewSet() *Set {
@@ -140,17 +170,22 @@ func (s *Set) Has(search []byte) bool {
 
 // Exec executes the diff created by Add() and Remove(), and saves the data to Riak
 func (s *Set) Exec(client *Session) error {
+	return s.ExecContext(context.Background(), client)
+}
+
+// ExecContext is the same as Exec, but aborts the request when ctx is cancelled or reaches its deadline
+func (s *Set) ExecContext(ctx context.Context, client *Session) error {
 	if s == nil {
-		return errors.New("Nil Set")
+		return uninitializedError("Nil Set")
 	}
 
 	if s.name == "" {
-		return errors.New("Unknown path to Set. Retrieve Set with Get or Set before updating the Set")
+		return uninitializedError("Unknown path to Set. Retrieve Set with Get or Set before updating the Set")
 	}
 
 	// Validate s.key
 	if s.key.bucket == "" || s.key.bucketType == "" || s.key.key == "" {
-		return errors.New("Invalid key in Set Exec()")
+		return uninitializedError("Invalid key in Set Exec()")
 	}
 
 	op := &riak.MapOperation{}
@@ -171,44 +206,35 @@ func (s *Set) Exec(client *Session) error {
 		op.RemoveFromSet(s.name, val)
 	}
 
-	cmd, err := riak.NewUpdateMapCommandBuilder().
-		WithBucket(s.key.bucket).
-		WithBucketType(s.key.bucketType).
-		WithKey(s.key.key).
-		WithMapOperation(outerOp).
-		WithContext(s.context).
-		WithReturnBody(true).
-		Build()
-
-	if err != nil {
-		return err
+	req := &updateMapRequest{
+		bucket:     s.key.bucket,
+		bucketType: s.key.bucketType,
+		key:        s.key.key,
+		op:         outerOp,
+		context:    s.context,
+		returnBody: true,
 	}
 
-	err = client.riak.Execute(cmd)
+	err := s.execute(ctx, client, req)
 
 	if err != nil {
 		return err
 	}
 
-	res, ok := cmd.(*riak.UpdateMapCommand)
-
-	if !ok {
-		return errors.New("Could not convert")
-	}
-
-	if !res.Success() {
-		return errors.New("Not successful")
+	// The middleware did not execute the request
+	if req.response == nil {
+		return nil
 	}
 
 	// Update internal status
-	resMap := res.Response.Map
+	resMap := req.response.Map
 
 	for _, subMapName := range s.path {
 		resMap = resMap.Maps[subMapName]
 	}
 
 	s.value = resMap.Sets[s.name]
-	s.context = res.Response.Context
+	s.context = req.response.Context
 
 	return nil
 }
@@ -113,7 +113,7 @@ func TestSiblingsRaw(t *testing.T) {
 	}
 
 	var out []byte
-	_, err = Bucket("sibs", "tests").
+	res, err := Bucket("sibs", "tests").
 		GetRaw(key, &out).
 		ConflictResolver(resolver).
 		Run(c)
@@ -126,6 +126,10 @@ func TestSiblingsRaw(t *testing.T) {
 		t.Error("Did not do conflict resolution")
 	}
 
+	if res == nil || res.Siblings != 2 {
+		t.Error("unexpected result:", res)
+	}
+
 	didConflictResolution = false
 
 	_, err = Bucket("sibs", "tests").
@@ -0,0 +1,15 @@
+module github.com/zegl/goriak/v3/slog
+
+go 1.21
+
+require github.com/zegl/goriak/v3 v3.3.0
+
+require (
+	github.com/basho/backoff v0.0.0-20150307023525-2ff7c4694083 // indirect
+	github.com/basho/riak-go-client v0.0.0-20170327205844-5587c16e0b8b // indirect
+	github.com/golang/protobuf v1.1.0 // indirect
+)
+
+// The goriak in the parent directory is used when developing in this repository.
+// Replace directives are ignored when the module is used as a dependency.
+replace github.com/zegl/goriak/v3 => ../
@@ -0,0 +1,95 @@
+// Package slog provides a goriak middleware that logs commands with log/slog.
+//
+//	session.Use(slog.Middleware(logger, slog.Policy{}))
+package slog
+
+import (
+	"errors"
+	"log/slog"
+	"math/rand"
+	"regexp"
+	"time"
+
+	goriak "github.com/zegl/goriak/v3"
+)
+
+// Policy configures Middleware
+type Policy struct {
+	// Level is the level of successful commands. Failed commands are logged at slog.LevelError,
+	// and slow commands at slog.LevelWarn. Defaults to slog.LevelInfo.
+	Level slog.Level
+
+	// SampleRate is the fraction of successful commands that are logged, between 0 and 1.
+	// Failed and slow commands are always logged. Defaults to 1, all commands are logged.
+	SampleRate float64
+
+	// SlowThreshold is the duration after which a command is considered slow. 0 disables slow command logging.
+	SlowThreshold time.Duration
+
+	// RedactKeys replaces keys that match the expression with "[REDACTED]" in the log
+	RedactKeys *regexp.Regexp
+}
+
+// Middleware returns a middleware that logs every command to logger, with the bucket, bucket type, key,
+// operation, duration, result and error. The result is "ok", "not_found" or "error".
+// The record is logged with the context of the command.
+func Middleware(logger *slog.Logger, policy Policy) goriak.RunMiddleware {
+	if policy.SampleRate <= 0 || policy.SampleRate > 1 {
+		policy.SampleRate = 1
+	}
+
+	return func(cmd goriak.RunMiddlewarer, next func() (*goriak.Result, error)) (*goriak.Result, error) {
+		start := time.Now()
+		res, err := next()
+		duration := time.Since(start)
+
+		level := policy.Level
+		result := "ok"
+
+		switch {
+		case errors.Is(err, goriak.ErrNotFound) || (err == nil && res != nil && res.NotFound):
+			result = "not_found"
+		case err != nil:
+			result = "error"
+			level = slog.LevelError
+		}
+
+		slow := policy.SlowThreshold > 0 && duration >= policy.SlowThreshold
+		if slow && level < slog.LevelWarn {
+			level = slog.LevelWarn
+		}
+
+		ctx := cmd.Context()
+
+		if !logger.Enabled(ctx, level) {
+			return res, err
+		}
+
+		// Failed and slow commands are not sampled
+		if result != "error" && !slow && policy.SampleRate < 1 && rand.Float64() >= policy.SampleRate {
+			return res, err
+		}
+
+		key := cmd.Key()
+		if policy.RedactKeys != nil && policy.RedactKeys.MatchString(key) {
+			key = "[REDACTED]"
+		}
+
+		attrs := []slog.Attr{
+			slog.String("bucket", cmd.Bucket()),
+			slog.String("bucket_type", cmd.BucketType()),
+			slog.String("key", key),
+			slog.String("operation", string(cmd.Operation())),
+			slog.Duration("duration", duration),
+			slog.String("result", result),
+		}
+
+		if result == "error" {
+			attrs = append(attrs, slog.String("error", err.Error()))
+		}
+
+		logger.LogAttrs(ctx, level, "riak command", attrs...)
+
+		return res, err
+	}
+}
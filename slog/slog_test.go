@@ -0,0 +1,131 @@
+package slog
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	goriak "github.com/zegl/goriak/v3"
+)
+
+// logEntries parses the JSON log lines in buf
+func logEntries(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var entries []map[string]interface{}
+
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal(err)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+func TestMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	b := goriak.Bucket("log", "default").RegisterRunMiddleware(Middleware(logger, Policy{
+		RedactKeys: regexp.MustCompile("^secret-"),
+	}))
+
+	session := goriak.NewMemorySession()
+	key := "key"
+
+	b.SetRaw([]byte("a")).Key(key).Run(session)
+
+	var raw []byte
+	b.GetRaw("secret-"+key, &raw).Run(session)
+
+	entries := logEntries(t, &buf)
+	if len(entries) != 2 {
+		t.Fatal("unexpected number of entries:", len(entries))
+	}
+
+	set := entries[0]
+
+	if set["msg"] != "riak command" || set["level"] != "INFO" || set["bucket"] != "log" || set["bucket_type"] != "default" ||
+		set["key"] != key || set["operation"] != "set_raw" || set["result"] != "ok" {
+		t.Error("unexpected entry:", set)
+	}
+
+	if _, ok := set["duration"]; !ok {
+		t.Error("no duration")
+	}
+
+	get := entries[1]
+
+	if get["key"] != "[REDACTED]" || get["result"] != "not_found" || get["level"] != "INFO" {
+		t.Error("unexpected entry:", get)
+	}
+}
+
+func TestMiddlewareErrorsAndSampling(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	session := goriak.NewMemorySession()
+
+	b := goriak.Bucket("log", "default").RegisterRunMiddleware(Middleware(logger, Policy{
+		SampleRate: 0.000001,
+	}))
+
+	// Sampled out
+	for i := 0; i < 10; i++ {
+		b.Delete("key").Run(session)
+	}
+
+	session.Close()
+
+	// Errors are always logged
+	b.Delete("key").Run(session)
+
+	entries := logEntries(t, &buf)
+	if len(entries) != 1 {
+		t.Fatal("unexpected number of entries:", len(entries))
+	}
+
+	if entries[0]["level"] != "ERROR" || entries[0]["result"] != "error" || entries[0]["error"] != goriak.ErrSessionClosed.Error() {
+		t.Error("unexpected entry:", entries[0])
+	}
+}
+
+func TestMiddlewareSlow(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelWarn}))
+
+	slow := func(cmd goriak.RunMiddlewarer, next func() (*goriak.Result, error)) (*goriak.Result, error) {
+		time.Sleep(10 * time.Millisecond)
+		return next()
+	}
+
+	session := goriak.NewMemorySession()
+
+	b := goriak.Bucket("log", "default").
+		RegisterRunMiddleware(Middleware(logger, Policy{SlowThreshold: 5 * time.Millisecond})).
+		RegisterRunMiddleware(slow)
+
+	b.Delete("key").Run(session)
+
+	// Fast commands are below the level of the handler
+	goriak.Bucket("log", "default").
+		RegisterRunMiddleware(Middleware(logger, Policy{SlowThreshold: time.Second})).
+		Delete("key").
+		Run(session)
+
+	entries := logEntries(t, &buf)
+	if len(entries) != 1 || entries[0]["level"] != "WARN" {
+		t.Error("unexpected entries:", entries)
+	}
+}
@@ -0,0 +1,94 @@
+package goriak
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net"
+
+	riak "github.com/basho/riak-go-client"
+)
+
+// authOptions builds the authentication options for connecting to Riak with security enabled.
+// nil is returned if no User is set.
+func (o ConnectOpts) authOptions() (*riak.AuthOptions, error) {
+	if o.User == "" {
+		if o.TLSConfig != nil || o.ClientCert != "" {
+			return nil, errors.New("goriak: User is required when TLS is used")
+		}
+
+		return nil, nil
+	}
+
+	var tlsConf *tls.Config
+
+	if o.TLSConfig != nil {
+		tlsConf = o.TLSConfig.Clone()
+	} else {
+		tlsConf = &tls.Config{}
+	}
+
+	if o.InsecureSkipVerify {
+		tlsConf.InsecureSkipVerify = true
+	}
+
+	if o.CARootCert != "" {
+		rootCertPemData, err := ioutil.ReadFile(o.CARootCert)
+		if err != nil {
+			return nil, errors.New("Opening CARootCert: " + err.Error())
+		}
+
+		rootCertPool := x509.NewCertPool()
+		if !rootCertPool.AppendCertsFromPEM(rootCertPemData) {
+			return nil, errors.New("Invalid PEM certificate file")
+		}
+
+		tlsConf.RootCAs = rootCertPool
+	}
+
+	if o.ClientCert != "" || o.ClientKey != "" {
+		if o.ClientCert == "" || o.ClientKey == "" {
+			return nil, errors.New("goriak: both ClientCert and ClientKey must be set")
+		}
+
+		cert, err := tls.LoadX509KeyPair(o.ClientCert, o.ClientKey)
+		if err != nil {
+			return nil, errors.New("Opening ClientCert and ClientKey: " + err.Error())
+		}
+
+		tlsConf.Certificates = append(tlsConf.Certificates, cert)
+	}
+
+	return &riak.AuthOptions{
+		User:      o.User,
+		Password:  o.Password,
+		TlsConfig: tlsConf,
+	}, nil
+}
+
+// nodeAuthOptions returns a copy of auth for the node at address (HOST:PORT).
+// Each node gets its own TLS configuration, with ServerName set to the host of the node
+// unless a ServerName was explicitly configured.
+func nodeAuthOptions(auth *riak.AuthOptions, address string) *riak.AuthOptions {
+	if auth == nil {
+		return nil
+	}
+
+	tlsConf := auth.TlsConfig.Clone()
+
+	if tlsConf.ServerName == "" {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			host = address
+		}
+
+		tlsConf.ServerName = host
+	}
+
+	return &riak.AuthOptions{
+		User:      auth.User,
+		Password:  auth.Password,
+		TlsConfig: tlsConf,
+	}
+}
@@ -0,0 +1,152 @@
+package goriak
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCertificate creates a self signed certificate and key in dir
+func writeTestCertificate(t *testing.T, dir string) (certPath, keyPath string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "riakuser"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPath = filepath.Join(dir, "cert.pem")
+	keyPath = filepath.Join(dir, "key.pem")
+
+	ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+
+	return certPath, keyPath
+}
+
+func TestTLSVerifiedByDefault(t *testing.T) {
+	certPath, _ := writeTestCertificate(t, t.TempDir())
+
+	auth, err := ConnectOpts{
+		User:       "riakuser",
+		Password:   "secret",
+		CARootCert: certPath,
+	}.authOptions()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if auth.TlsConfig.InsecureSkipVerify {
+		t.Error("InsecureSkipVerify is set")
+	}
+
+	if auth.TlsConfig.RootCAs == nil {
+		t.Error("RootCAs is not set")
+	}
+
+	if auth.User != "riakuser" || auth.Password != "secret" {
+		t.Error("unexpected credentials")
+	}
+}
+
+func TestTLSClientCertificate(t *testing.T) {
+	certPath, keyPath := writeTestCertificate(t, t.TempDir())
+
+	auth, err := ConnectOpts{
+		User:       "riakuser",
+		ClientCert: certPath,
+		ClientKey:  keyPath,
+	}.authOptions()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(auth.TlsConfig.Certificates) != 1 {
+		t.Error("client certificate was not loaded")
+	}
+
+	_, err = ConnectOpts{
+		User:       "riakuser",
+		ClientCert: certPath,
+	}.authOptions()
+	if err == nil {
+		t.Error("no error when ClientKey is missing")
+	}
+}
+
+func TestTLSCustomConfig(t *testing.T) {
+	conf := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	opts := ConnectOpts{
+		User:      "riakuser",
+		TLSConfig: conf,
+	}
+
+	auth, err := opts.authOptions()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if auth.TlsConfig == conf || auth.TlsConfig.MinVersion != tls.VersionTLS12 {
+		t.Error("TLSConfig was not cloned")
+	}
+
+	// Every node gets its own ServerName
+	a := nodeAuthOptions(auth, "riak1.example.com:8087")
+	b := nodeAuthOptions(auth, "riak2.example.com:8087")
+
+	if a.TlsConfig.ServerName != "riak1.example.com" || b.TlsConfig.ServerName != "riak2.example.com" {
+		t.Error("unexpected ServerName:", a.TlsConfig.ServerName, b.TlsConfig.ServerName)
+	}
+
+	if conf.ServerName != "" || auth.TlsConfig.ServerName != "" {
+		t.Error("ServerName was set on the shared config")
+	}
+
+	// An explicit ServerName is kept
+	conf.ServerName = "riak.example.com"
+
+	auth, _ = opts.authOptions()
+	a = nodeAuthOptions(auth, "10.0.0.1:8087")
+
+	if a.TlsConfig.ServerName != "riak.example.com" {
+		t.Error("unexpected ServerName:", a.TlsConfig.ServerName)
+	}
+
+	_, err = ConnectOpts{TLSConfig: conf}.authOptions()
+	if err == nil {
+		t.Error("no error when User is missing")
+	}
+}